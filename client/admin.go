@@ -17,6 +17,9 @@ package client
 import (
 	"net"
 	"net/http"
+	"net/http/pprof"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/fatedier/frp/assets"
@@ -30,19 +33,135 @@ var (
 	httpServerWriteTimeout = 10 * time.Second
 )
 
+// newCorsMiddleware emits Access-Control-Allow-* headers for requests from
+// the configured origins and short-circuits OPTIONS preflights. Origins must
+// be listed explicitly; "*" opts into allowing any origin.
+func newCorsMiddleware(allowedOrigins []string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			allowed := false
+			for _, o := range allowedOrigins {
+				if o == "*" || o == origin {
+					allowed = true
+					break
+				}
+			}
+			if origin != "" && allowed {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Vary", "Origin")
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-Match")
+				if r.Method == http.MethodOptions {
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// newReadOnlyMiddleware refuses mutating requests so the API can be exposed
+// for monitoring only. Everything non-GET is blocked, and so is /api/reload,
+// which mutates the running config despite being a GET.
+func newReadOnlyMiddleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mutating := r.Method != http.MethodGet && r.Method != http.MethodOptions
+			if mutating || r.URL.Path == "/api/reload" {
+				http.Error(w, "the admin API is in read-only mode", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func (svr *Service) RunAdminServer(address string) (err error) {
 	// url router
 	router := mux.NewRouter()
 
+	// cors runs before auth so preflight requests, which carry no
+	// credentials, are answered instead of rejected
+	if len(svr.cfg.AdminCorsOrigins) > 0 {
+		router.Use(newCorsMiddleware(svr.cfg.AdminCorsOrigins))
+	}
+
 	user, passwd := svr.cfg.AdminUser, svr.cfg.AdminPwd
 	router.Use(frpNet.NewHTTPAuthMiddleware(user, passwd).Middleware)
 
+	if svr.cfg.AdminReadOnly {
+		router.Use(newReadOnlyMiddleware())
+	}
+
+	// pprof debug handlers are only registered when explicitly enabled, so
+	// profiles are never exposed by accident; they share the admin auth
+	if svr.cfg.PprofEnable {
+		router.HandleFunc("/api/debug/pprof/cmdline", pprof.Cmdline).Methods("GET")
+		router.HandleFunc("/api/debug/pprof/profile", pprof.Profile).Methods("GET")
+		router.HandleFunc("/api/debug/pprof/symbol", pprof.Symbol).Methods("GET")
+		router.HandleFunc("/api/debug/pprof/trace", pprof.Trace).Methods("GET")
+		router.PathPrefix("/api/debug/pprof/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			name := strings.TrimPrefix(r.URL.Path, "/api/debug/pprof/")
+			pprof.Handler(name).ServeHTTP(w, r)
+		}).Methods("GET")
+	}
+
 	// api, see dashboard_api.go
+	router.HandleFunc("/api/reload/status", svr.apiReloadStatus).Methods("GET")
+	router.HandleFunc("/api/reload/proxy/{name}", svr.apiReloadProxy).Methods("POST")
+	router.HandleFunc("/api/stop", svr.apiStop).Methods("POST")
 	router.HandleFunc("/api/reload", svr.apiReload).Methods("GET")
+	router.HandleFunc("/api/info", svr.apiInfo).Methods("GET")
+	// alias kept alongside /api/info for clients expecting this name
+	router.HandleFunc("/api/serverinfo", svr.apiInfo).Methods("GET")
+	router.HandleFunc("/api/status/stream", svr.apiStatusStream).Methods("GET")
+	router.HandleFunc("/api/status/{name}/history", svr.apiStatusHistory).Methods("GET")
+	router.HandleFunc("/api/status/summary", svr.apiStatusSummary).Methods("GET")
 	router.HandleFunc("/api/status", svr.apiStatus).Methods("GET")
+	router.HandleFunc("/api/visitor/status", svr.apiVisitorStatus).Methods("GET")
+	router.HandleFunc("/api/health", svr.apiHealth).Methods("GET")
+	router.HandleFunc("/api/logs", svr.apiLogs).Methods("GET")
+	router.HandleFunc("/api/metrics", svr.apiMetrics).Methods("GET")
+	router.HandleFunc("/api/config/runtime", svr.apiRuntimeConfig).Methods("GET")
 	router.HandleFunc("/api/config", svr.apiGetConfig).Methods("GET")
 	router.HandleFunc("/api/config", svr.apiPutConfig).Methods("PUT")
 
+	router.HandleFunc("/api/schema/proxy/{type}", svr.apiProxySchema).Methods("GET")
+	router.HandleFunc("/api/schema/visitor/{type}", svr.apiVisitorSchema).Methods("GET")
+	router.HandleFunc("/api/validate/proxy", svr.apiValidateProxy).Methods("POST")
+	router.HandleFunc("/api/validate/visitor", svr.apiValidateVisitor).Methods("POST")
+
+	// store, see store_api.go
+	router.HandleFunc("/api/store", svr.apiReplaceStore).Methods("PUT")
+	router.HandleFunc("/api/store/rollback", svr.apiRollbackStore).Methods("POST")
+	router.HandleFunc("/api/store/export", svr.apiExportStore).Methods("GET")
+	router.HandleFunc("/api/store/diff", svr.apiStoreDiff).Methods("GET")
+	router.HandleFunc("/api/store/stats", svr.apiStoreStats).Methods("GET")
+	router.HandleFunc("/api/store/groups", svr.apiListStoreGroups).Methods("GET")
+	router.HandleFunc("/api/store/groups/{group}/enable", svr.apiEnableStoreGroup).Methods("POST")
+	router.HandleFunc("/api/store/groups/{group}/disable", svr.apiDisableStoreGroup).Methods("POST")
+	router.HandleFunc("/api/store/proxies:batch", svr.apiBulkCreateStoreProxies).Methods("POST")
+	router.HandleFunc("/api/store/proxies", svr.apiCreateStoreProxy).Methods("POST")
+	router.HandleFunc("/api/store/proxies", svr.apiListStoreProxies).Methods("GET")
+	router.HandleFunc("/api/store/proxies/{name}/rename", svr.apiRenameStoreProxy).Methods("POST")
+	router.HandleFunc("/api/store/proxies/{name}/clone", svr.apiCloneStoreProxy).Methods("POST")
+	router.HandleFunc("/api/store/proxies/{name}/healthcheck", svr.apiSetStoreProxyHealthCheck).Methods("POST")
+	router.HandleFunc("/api/store/proxies/{name}/test", svr.apiTestStoreProxyBackend).Methods("POST")
+	router.HandleFunc("/api/store/proxies/{name}/bandwidth", svr.apiSetStoreProxyBandwidth).Methods("POST")
+	router.HandleFunc("/api/store/proxies/{name}/enable", svr.apiEnableStoreProxy).Methods("POST")
+	router.HandleFunc("/api/store/proxies/{name}/disable", svr.apiDisableStoreProxy).Methods("POST")
+	router.HandleFunc("/api/store/proxies/{name}", svr.apiGetStoreProxy).Methods("GET")
+	router.HandleFunc("/api/store/proxies/{name}", svr.apiUpdateStoreProxy).Methods("PUT")
+	router.HandleFunc("/api/store/proxies/{name}", svr.apiPatchStoreProxy).Methods("PATCH")
+	router.HandleFunc("/api/store/proxies/{name}", svr.apiDeleteStoreProxy).Methods("DELETE")
+	router.HandleFunc("/api/store/visitors", svr.apiCreateStoreVisitor).Methods("POST")
+	router.HandleFunc("/api/store/visitors", svr.apiListStoreVisitors).Methods("GET")
+	router.HandleFunc("/api/store/visitors/{name}", svr.apiGetStoreVisitor).Methods("GET")
+	router.HandleFunc("/api/store/visitors/{name}", svr.apiUpdateStoreVisitor).Methods("PUT")
+	router.HandleFunc("/api/store/visitors/{name}", svr.apiDeleteStoreVisitor).Methods("DELETE")
+
 	// view
 	router.Handle("/favicon.ico", http.FileServer(assets.FileSystem)).Methods("GET")
 	router.PathPrefix("/static/").Handler(frpNet.MakeHTTPGzipHandler(http.StripPrefix("/static/", http.FileServer(assets.FileSystem)))).Methods("GET")
@@ -56,12 +175,30 @@ func (svr *Service) RunAdminServer(address string) (err error) {
 		ReadTimeout:  httpServerReadTimeout,
 		WriteTimeout: httpServerWriteTimeout,
 	}
-	if address == "" {
-		address = ":http"
-	}
-	ln, err := net.Listen("tcp", address)
-	if err != nil {
-		return err
+
+	var ln net.Listener
+	if strings.HasPrefix(address, "unix://") {
+		// a unix domain socket keeps the API local-only; a stale socket from
+		// a previous run is removed first, and permissions are tightened so
+		// only the owner can talk to it
+		path := strings.TrimPrefix(address, "unix://")
+		if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if ln, err = net.Listen("unix", path); err != nil {
+			return err
+		}
+		if err = os.Chmod(path, 0600); err != nil {
+			ln.Close()
+			return err
+		}
+	} else {
+		if address == "" {
+			address = ":http"
+		}
+		if ln, err = net.Listen("tcp", address); err != nil {
+			return err
+		}
 	}
 
 	go server.Serve(ln)
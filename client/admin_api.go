@@ -15,16 +15,28 @@
 package client
 
 import (
+	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/fatedier/frp/client/proxy"
 	"github.com/fatedier/frp/pkg/config"
 	"github.com/fatedier/frp/pkg/util/log"
+	"github.com/fatedier/frp/pkg/util/version"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
 )
 
 type GeneralResponse struct {
@@ -32,6 +44,67 @@ type GeneralResponse struct {
 	Msg  string
 }
 
+// ReloadStatusResp reports whether a reload is executing and when the last
+// successful reload finished.
+type ReloadStatusResp struct {
+	Reloading      bool   `json:"reloading"`
+	LastReloadTime string `json:"last_reload_time,omitempty"`
+}
+
+// stopDefaultDrainTimeout is how long Stop waits for in-flight connections
+// to drain when no timeout parameter is supplied.
+const stopDefaultDrainTimeout = 100 * time.Millisecond
+
+// POST api/stop?timeout=30s
+func (svr *Service) apiStop(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+
+	log.Info("Http request [/api/stop]")
+	defer func() {
+		log.Info("Http response [/api/stop], code [%d]", res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+
+	timeout := stopDefaultDrainTimeout
+	if str := r.URL.Query().Get("timeout"); str != "" {
+		d, err := time.ParseDuration(str)
+		if err != nil || d < 0 {
+			res.Code = 400
+			res.Msg = fmt.Sprintf("invalid timeout [%s]", str)
+			log.Warn("%s", res.Msg)
+			return
+		}
+		timeout = d
+	}
+
+	go svr.GracefulStop(timeout)
+}
+
+// GET api/reload/status
+func (svr *Service) apiReloadStatus(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+
+	log.Info("Http request [/api/reload/status]")
+	defer func() {
+		log.Info("Http response [/api/reload/status], code [%d]", res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+
+	reloading, last := svr.ReloadInProgress()
+	resp := ReloadStatusResp{Reloading: reloading}
+	if !last.IsZero() {
+		resp.LastReloadTime = last.Format(time.RFC3339)
+	}
+	buf, _ := json.Marshal(&resp)
+	res.Msg = string(buf)
+}
+
 // GET api/reload
 func (svr *Service) apiReload(w http.ResponseWriter, r *http.Request) {
 	res := GeneralResponse{Code: 200}
@@ -45,7 +118,16 @@ func (svr *Service) apiReload(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
-	_, pxyCfgs, visitorCfgs, err := config.ParseClientConfig(svr.cfgFile)
+	// a config file whose content hash matches the last applied reload is
+	// skipped outright, which keeps polling-based reload calls cheap
+	fileHash := svr.cfgFileHash()
+	if r.URL.Query().Get("dryRun") != "true" && svr.cfgFileUnchanged(fileHash) {
+		res.Msg = `{"changed": false}`
+		log.Info("reload skipped, config file unchanged")
+		return
+	}
+
+	pxyCfgs, visitorCfgs, err := svr.buildConfFromSources()
 	if err != nil {
 		res.Code = 400
 		res.Msg = err.Error()
@@ -53,16 +135,75 @@ func (svr *Service) apiReload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// with dryRun the config is fully parsed and validated but never applied,
+	// so CI can verify a config without disturbing the running client
+	if r.URL.Query().Get("dryRun") == "true" {
+		log.Info("reload config dry-run succeeded")
+		return
+	}
+
 	if err = svr.ReloadConf(pxyCfgs, visitorCfgs); err != nil {
 		res.Code = 500
 		res.Msg = err.Error()
 		log.Warn("reload frpc proxy config error: %s", res.Msg)
 		return
 	}
+	svr.setCfgFileHash(fileHash)
+	res.Msg = `{"changed": true}`
 	log.Info("success reload conf")
 	return
 }
 
+// POST api/reload/proxy/{name}
+func (svr *Service) apiReloadProxy(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+	name := mux.Vars(r)["name"]
+
+	log.Info("Http request [/api/reload/proxy/%s]", name)
+	defer func() {
+		log.Info("Http response [/api/reload/proxy/%s], code [%d]", name, res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+
+	if err := svr.ReloadProxy(name); err != nil {
+		if errors.Is(err, ErrProxyNotFound) {
+			res.Code = 404
+		} else {
+			res.Code = 400
+		}
+		res.Msg = err.Error()
+		log.Warn("reload frpc proxy [%s] error: %s", name, res.Msg)
+		return
+	}
+	log.Info("success reload proxy [%s]", name)
+}
+
+type InfoResp struct {
+	Version    string `json:"version"`
+	ServerAddr string `json:"server_addr"`
+}
+
+// GET api/info
+func (svr *Service) apiInfo(w http.ResponseWriter, r *http.Request) {
+	var (
+		buf []byte
+		res InfoResp
+	)
+
+	log.Info("Http request [/api/info]")
+	defer func() {
+		log.Info("Http response [/api/info]")
+		buf, _ = json.Marshal(&res)
+		w.Write(buf)
+	}()
+
+	res.Version = version.Full()
+	res.ServerAddr = svr.currentServerAddr()
+}
+
 type StatusResp struct {
 	TCP   []ProxyStatusResp `json:"tcp"`
 	UDP   []ProxyStatusResp `json:"udp"`
@@ -73,14 +214,22 @@ type StatusResp struct {
 	SUDP  []ProxyStatusResp `json:"sudp"`
 }
 
+// Proxy config sources reported in ProxyStatusResp.
+const (
+	ProxySourceFile  = "file"
+	ProxySourceStore = "store"
+)
+
 type ProxyStatusResp struct {
-	Name       string `json:"name"`
-	Type       string `json:"type"`
-	Status     string `json:"status"`
-	Err        string `json:"err"`
-	LocalAddr  string `json:"local_addr"`
-	Plugin     string `json:"plugin"`
-	RemoteAddr string `json:"remote_addr"`
+	Name           string `json:"name"`
+	Type           string `json:"type"`
+	Status         string `json:"status"`
+	Err            string `json:"err"`
+	LocalAddr      string `json:"local_addr"`
+	Plugin         string `json:"plugin"`
+	RemoteAddr     string `json:"remote_addr"`
+	ThrottledConns uint64 `json:"throttled_conns"`
+	Source         string `json:"source"`
 }
 
 type ByProxyStatusResp []ProxyStatusResp
@@ -89,12 +238,40 @@ func (a ByProxyStatusResp) Len() int           { return len(a) }
 func (a ByProxyStatusResp) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a ByProxyStatusResp) Less(i, j int) bool { return strings.Compare(a[i].Name, a[j].Name) < 0 }
 
+// storeProxyNameSet returns the full names of store-managed proxies as one
+// consistent snapshot, so status builders can annotate Source with a map
+// lookup instead of consulting the store once per proxy.
+func (svr *Service) storeProxyNameSet() map[string]struct{} {
+	set := make(map[string]struct{})
+	if svr.store == nil {
+		return set
+	}
+	for _, name := range svr.store.GetAllProxyNames() {
+		set[config.FullProxyName(svr.cfg.User, name)] = struct{}{}
+	}
+	return set
+}
+
+// newProxyStatusResp builds a status response and records which config
+// source owns the proxy, checked against a store name snapshot taken once
+// per request.
+func (svr *Service) newProxyStatusResp(status *proxy.WorkingStatus, storeNames map[string]struct{}) ProxyStatusResp {
+	psr := NewProxyStatusResp(status, svr.cfg.ServerAddr)
+	if _, ok := storeNames[status.Name]; ok {
+		psr.Source = ProxySourceStore
+	} else {
+		psr.Source = ProxySourceFile
+	}
+	return psr
+}
+
 func NewProxyStatusResp(status *proxy.WorkingStatus, serverAddr string) ProxyStatusResp {
 	psr := ProxyStatusResp{
-		Name:   status.Name,
-		Type:   status.Type,
-		Status: status.Phase,
-		Err:    status.Err,
+		Name:           status.Name,
+		Type:           status.Type,
+		Status:         status.Phase,
+		Err:            status.Err,
+		ThrottledConns: status.ThrottledConns,
 	}
 	switch cfg := status.Cfg.(type) {
 	case *config.TCPProxyConf:
@@ -147,6 +324,139 @@ func NewProxyStatusResp(status *proxy.WorkingStatus, serverAddr string) ProxySta
 	return psr
 }
 
+// StatusSummaryResp is the minimal payload for status badges: proxy counts
+// with no per-proxy data.
+type StatusSummaryResp struct {
+	Total   int `json:"total"`
+	Running int `json:"running"`
+	Error   int `json:"error"`
+}
+
+// GET api/status/summary
+func (svr *Service) apiStatusSummary(w http.ResponseWriter, r *http.Request) {
+	var (
+		buf []byte
+		res StatusSummaryResp
+	)
+
+	log.Info("Http request [/api/status/summary]")
+	defer func() {
+		log.Info("Http response [/api/status/summary]")
+		buf, _ = json.Marshal(&res)
+		w.Write(buf)
+	}()
+
+	for _, status := range svr.ctl.pm.GetAllProxyStatus() {
+		res.Total++
+		switch status.Phase {
+		case proxy.ProxyPhaseRunning:
+			res.Running++
+		case proxy.ProxyPhaseStartErr, proxy.ProxyPhaseCheckFailed:
+			res.Error++
+		}
+	}
+}
+
+// GET api/schema/proxy/{type}, GET api/schema/visitor/{type}
+//
+// Plugins take free-form plugin_* parameters in this codebase and have no
+// typed options struct, so only proxy and visitor schemas are exposed.
+func (svr *Service) apiConfigSchema(w http.ResponseWriter, r *http.Request, schema func(string) (map[string]interface{}, error)) {
+	res := GeneralResponse{Code: 200}
+	kind := mux.Vars(r)["type"]
+
+	log.Info("Http request [%s]", r.URL.Path)
+	defer func() {
+		log.Info("Http response [%s], code [%d]", r.URL.Path, res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+
+	s, err := schema(kind)
+	if err != nil {
+		res.Code = 404
+		res.Msg = err.Error()
+		return
+	}
+	buf, _ := json.Marshal(s)
+	res.Msg = string(buf)
+}
+
+func (svr *Service) apiProxySchema(w http.ResponseWriter, r *http.Request) {
+	svr.apiConfigSchema(w, r, config.ProxyConfSchema)
+}
+
+func (svr *Service) apiVisitorSchema(w http.ResponseWriter, r *http.Request) {
+	svr.apiConfigSchema(w, r, config.VisitorConfSchema)
+}
+
+// GET api/visitor/status
+func (svr *Service) apiVisitorStatus(w http.ResponseWriter, r *http.Request) {
+	var buf []byte
+	res := make([]VisitorStatus, 0)
+
+	log.Info("Http request [/api/visitor/status]")
+	defer func() {
+		log.Info("Http response [/api/visitor/status]")
+		buf, _ = json.Marshal(res)
+		w.Write(buf)
+	}()
+
+	res = svr.ctl.vm.GetAllVisitorStatus()
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+}
+
+// GET api/logs
+//
+// Serves the recent log entries buffered in memory by the log package, so
+// reload and validation failures can be diagnosed through the admin API
+// without shell access to the host.
+func (svr *Service) apiLogs(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+
+	log.Info("Http request [/api/logs]")
+	defer func() {
+		log.Info("Http response [/api/logs], code [%d]", res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+
+	query := r.URL.Query()
+	level := query.Get("level")
+	if level != "" && !log.ValidLevel(level) {
+		res.Code = 400
+		res.Msg = fmt.Sprintf("unknown log level [%s]", level)
+		return
+	}
+	var since time.Time
+	if v := query.Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			res.Code = 400
+			res.Msg = "since should be an RFC3339 timestamp"
+			return
+		}
+		since = t
+	}
+	limit := 0
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			res.Code = 400
+			res.Msg = "limit should be a non-negative integer"
+			return
+		}
+		limit = n
+	}
+
+	buf, _ := json.Marshal(log.Recent(level, since, limit))
+	res.Msg = string(buf)
+}
+
 // GET api/status
 func (svr *Service) apiStatus(w http.ResponseWriter, r *http.Request) {
 	var (
@@ -161,6 +471,20 @@ func (svr *Service) apiStatus(w http.ResponseWriter, r *http.Request) {
 	res.XTCP = make([]ProxyStatusResp, 0)
 	res.SUDP = make([]ProxyStatusResp, 0)
 
+	// filter=<regex> keeps only proxies whose name matches, so clients
+	// don't have to pull the whole status map just to filter it
+	var filterRe *regexp.Regexp
+	if v := r.URL.Query().Get("filter"); v != "" {
+		re, err := regexp.Compile(v)
+		if err != nil {
+			log.Info("Http request [/api/status], code [400]")
+			w.WriteHeader(400)
+			w.Write([]byte(fmt.Sprintf("invalid filter regex [%s]: %v", v, err)))
+			return
+		}
+		filterRe = re
+	}
+
 	log.Info("Http request [/api/status]")
 	defer func() {
 		log.Info("Http response [/api/status]")
@@ -169,22 +493,26 @@ func (svr *Service) apiStatus(w http.ResponseWriter, r *http.Request) {
 	}()
 
 	ps := svr.ctl.pm.GetAllProxyStatus()
+	storeNames := svr.storeProxyNameSet()
 	for _, status := range ps {
+		if filterRe != nil && !filterRe.MatchString(status.Name) {
+			continue
+		}
 		switch status.Type {
 		case "tcp":
-			res.TCP = append(res.TCP, NewProxyStatusResp(status, svr.cfg.ServerAddr))
+			res.TCP = append(res.TCP, svr.newProxyStatusResp(status, storeNames))
 		case "udp":
-			res.UDP = append(res.UDP, NewProxyStatusResp(status, svr.cfg.ServerAddr))
+			res.UDP = append(res.UDP, svr.newProxyStatusResp(status, storeNames))
 		case "http":
-			res.HTTP = append(res.HTTP, NewProxyStatusResp(status, svr.cfg.ServerAddr))
+			res.HTTP = append(res.HTTP, svr.newProxyStatusResp(status, storeNames))
 		case "https":
-			res.HTTPS = append(res.HTTPS, NewProxyStatusResp(status, svr.cfg.ServerAddr))
+			res.HTTPS = append(res.HTTPS, svr.newProxyStatusResp(status, storeNames))
 		case "stcp":
-			res.STCP = append(res.STCP, NewProxyStatusResp(status, svr.cfg.ServerAddr))
+			res.STCP = append(res.STCP, svr.newProxyStatusResp(status, storeNames))
 		case "xtcp":
-			res.XTCP = append(res.XTCP, NewProxyStatusResp(status, svr.cfg.ServerAddr))
+			res.XTCP = append(res.XTCP, svr.newProxyStatusResp(status, storeNames))
 		case "sudp":
-			res.SUDP = append(res.SUDP, NewProxyStatusResp(status, svr.cfg.ServerAddr))
+			res.SUDP = append(res.SUDP, svr.newProxyStatusResp(status, storeNames))
 		}
 	}
 	sort.Sort(ByProxyStatusResp(res.TCP))
@@ -197,6 +525,284 @@ func (svr *Service) apiStatus(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
+var (
+	statusStreamPollInterval = time.Second
+
+	statusStreamUpgrader = websocket.Upgrader{
+		// the admin API is protected by basic auth and usually bound to
+		// localhost, so cross-origin upgrades are allowed
+		CheckOrigin: func(r *http.Request) bool { return true },
+	}
+)
+
+// StatusStreamEvent is one message on the status stream websocket. The first
+// message carries the full proxy status; later messages are per-proxy deltas
+// emitted when a proxy changes phase or disappears.
+type StatusStreamEvent struct {
+	Event   string            `json:"event"` // full, update, remove
+	Proxies []ProxyStatusResp `json:"proxies,omitempty"`
+	Proxy   *ProxyStatusResp  `json:"proxy,omitempty"`
+	Name    string            `json:"name,omitempty"`
+}
+
+// GET api/status/stream
+func (svr *Service) apiStatusStream(w http.ResponseWriter, r *http.Request) {
+	log.Info("Http request [/api/status/stream]")
+	conn, err := statusStreamUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Warn("websocket upgrade error: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	closeCh := make(chan struct{})
+	go func() {
+		// the client never sends application messages; reading only serves
+		// to detect the connection closing
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				close(closeCh)
+				return
+			}
+		}
+	}()
+
+	lastPhases := make(map[string]string)
+	full := make([]ProxyStatusResp, 0)
+	storeNames := svr.storeProxyNameSet()
+	for _, status := range svr.ctl.pm.GetAllProxyStatus() {
+		full = append(full, svr.newProxyStatusResp(status, storeNames))
+		lastPhases[status.Name] = status.Phase
+	}
+	sort.Sort(ByProxyStatusResp(full))
+	if err := conn.WriteJSON(&StatusStreamEvent{Event: "full", Proxies: full}); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(statusStreamPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closeCh:
+			return
+		case <-ticker.C:
+		}
+
+		seen := make(map[string]struct{})
+		storeNames = svr.storeProxyNameSet()
+		for _, status := range svr.ctl.pm.GetAllProxyStatus() {
+			seen[status.Name] = struct{}{}
+			if lastPhases[status.Name] == status.Phase {
+				continue
+			}
+			lastPhases[status.Name] = status.Phase
+			resp := svr.newProxyStatusResp(status, storeNames)
+			if err := conn.WriteJSON(&StatusStreamEvent{Event: "update", Proxy: &resp}); err != nil {
+				return
+			}
+		}
+		for name := range lastPhases {
+			if _, ok := seen[name]; ok {
+				continue
+			}
+			delete(lastPhases, name)
+			if err := conn.WriteJSON(&StatusStreamEvent{Event: "remove", Name: name}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// GET api/metrics
+//
+// apiMetrics emits the client's own view of its proxies in Prometheus text
+// format, independent of any server-side metrics.
+func (svr *Service) apiMetrics(w http.ResponseWriter, r *http.Request) {
+	log.Info("Http request [/api/metrics]")
+	defer log.Info("Http response [/api/metrics]")
+
+	ps := svr.ctl.pm.GetAllProxyStatus()
+	sort.Slice(ps, func(i, j int) bool { return ps[i].Name < ps[j].Name })
+
+	typeCounts := make(map[string]int)
+	for _, status := range ps {
+		typeCounts[status.Type]++
+	}
+	types := make([]string, 0, len(typeCounts))
+	for t := range typeCounts {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	var buf strings.Builder
+	buf.WriteString("# HELP frpc_proxy_up Whether the proxy is in the running phase.\n")
+	buf.WriteString("# TYPE frpc_proxy_up gauge\n")
+	for _, status := range ps {
+		up := 0
+		if status.Phase == proxy.ProxyPhaseRunning {
+			up = 1
+		}
+		fmt.Fprintf(&buf, "frpc_proxy_up{name=%q,type=%q} %d\n", status.Name, status.Type, up)
+	}
+	buf.WriteString("# HELP frpc_proxies Number of configured proxies by type.\n")
+	buf.WriteString("# TYPE frpc_proxies gauge\n")
+	for _, t := range types {
+		fmt.Fprintf(&buf, "frpc_proxies{type=%q} %d\n", t, typeCounts[t])
+	}
+	buf.WriteString("# HELP frpc_proxies_total Total number of configured proxies.\n")
+	buf.WriteString("# TYPE frpc_proxies_total gauge\n")
+	fmt.Fprintf(&buf, "frpc_proxies_total %d\n", len(ps))
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write([]byte(buf.String()))
+}
+
+// GET api/status/{name}/history
+func (svr *Service) apiStatusHistory(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+	name := mux.Vars(r)["name"]
+
+	log.Info("Http request [/api/status/%s/history]", name)
+	defer func() {
+		log.Info("Http response [/api/status/%s/history], code [%d]", name, res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+
+	history, ok := svr.ctl.pm.GetProxyStatusHistory(name)
+	if !ok {
+		res.Code = 404
+		res.Msg = fmt.Sprintf("no proxy status found for [%s]", name)
+		return
+	}
+
+	buf, _ := json.Marshal(history)
+	res.Msg = string(buf)
+}
+
+type HealthResp struct {
+	// Healthy is false if any proxy is in an error phase.
+	Healthy bool `json:"healthy"`
+	// Counts maps each proxy phase to the number of proxies in it.
+	Counts map[string]int `json:"counts"`
+}
+
+// GET api/health
+func (svr *Service) apiHealth(w http.ResponseWriter, r *http.Request) {
+	var (
+		buf []byte
+		res HealthResp
+	)
+	res.Healthy = true
+	res.Counts = make(map[string]int)
+
+	log.Info("Http request [/api/health]")
+	defer func() {
+		log.Info("Http response [/api/health]")
+		buf, _ = json.Marshal(&res)
+		w.Write(buf)
+	}()
+
+	ps := svr.ctl.pm.GetAllProxyStatus()
+	for _, status := range ps {
+		res.Counts[status.Phase]++
+		if status.Phase == proxy.ProxyPhaseStartErr || status.Phase == proxy.ProxyPhaseCheckFailed {
+			res.Healthy = false
+		}
+	}
+}
+
+// GET api/config/runtime
+func (svr *Service) apiRuntimeConfig(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+
+	log.Info("Http request [/api/config/runtime]")
+	defer func() {
+		log.Info("Http response [/api/config/runtime], code [%d]", res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+
+	rc := svr.GetRuntimeConfig()
+	buf, err := json.Marshal(&rc)
+	if err != nil {
+		res.Code = 500
+		res.Msg = err.Error()
+		return
+	}
+	// never expose credentials through the debugging endpoint: the token,
+	// admin password, oidc client secret, proxy/visitor sks, http_proxy
+	// (which may embed user:pass) and password-bearing plugin parameters
+	// are all blanked before serving
+	buf, err = redactConfigSecrets(buf)
+	if err != nil {
+		res.Code = 500
+		res.Msg = err.Error()
+		return
+	}
+	res.Msg = string(buf)
+}
+
+// redactedConfigKeys are credential fields blanked from the runtime config
+// dump, by exact json key; keys containing "passwd", "password" or "secret"
+// are blanked as well, which covers plugin parameters and the oidc client
+// secret.
+var redactedConfigKeys = map[string]bool{
+	"token":      true,
+	"admin_pwd":  true,
+	"sk":         true,
+	"http_pwd":   true,
+	"http_proxy": true,
+}
+
+func redactedConfigKey(key string) bool {
+	if redactedConfigKeys[key] {
+		return true
+	}
+	lower := strings.ToLower(key)
+	return strings.Contains(lower, "passwd") ||
+		strings.Contains(lower, "password") ||
+		strings.Contains(lower, "secret")
+}
+
+// redactConfigSecrets blanks every credential field in a JSON config dump.
+// It fails instead of falling back to the unredacted input, so a parse
+// problem can't leak secrets.
+func redactConfigSecrets(buf []byte) ([]byte, error) {
+	var v interface{}
+	if err := json.Unmarshal(buf, &v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(redactConfigValue(v))
+}
+
+func redactConfigValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, val := range t {
+			if redactedConfigKey(k) {
+				if s, ok := val.(string); ok && s != "" {
+					t[k] = ""
+				}
+				continue
+			}
+			t[k] = redactConfigValue(val)
+		}
+		return t
+	case []interface{}:
+		for i, val := range t {
+			t[i] = redactConfigValue(val)
+		}
+		return t
+	default:
+		return v
+	}
+}
+
 // GET api/config
 func (svr *Service) apiGetConfig(w http.ResponseWriter, r *http.Request) {
 	res := GeneralResponse{Code: 200}
@@ -250,16 +856,27 @@ func (svr *Service) apiPutConfig(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
-	// get new config content
-	body, err := ioutil.ReadAll(r.Body)
+	// stream the new config content to a staging file next to the config, so
+	// the upload never has to be buffered in memory
+	staging, err := ioutil.TempFile(filepath.Dir(svr.cfgFile), filepath.Base(svr.cfgFile)+".tmp")
+	if err != nil {
+		res.Code = 500
+		res.Msg = fmt.Sprintf("create temp config file error: %v", err)
+		log.Warn("%s", res.Msg)
+		return
+	}
+	stagingPath := staging.Name()
+	defer os.Remove(stagingPath)
+	defer staging.Close()
+
+	written, err := io.Copy(staging, r.Body)
 	if err != nil {
 		res.Code = 400
 		res.Msg = fmt.Sprintf("read request body error: %v", err)
 		log.Warn("%s", res.Msg)
 		return
 	}
-
-	if len(body) == 0 {
+	if written == 0 {
 		res.Code = 400
 		res.Msg = "body can't be empty"
 		log.Warn("%s", res.Msg)
@@ -267,51 +884,111 @@ func (svr *Service) apiPutConfig(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// get token from origin content
-	token := ""
-	b, err := ioutil.ReadFile(svr.cfgFile)
+	token, err := readConfigToken(svr.cfgFile)
 	if err != nil {
 		res.Code = 400
 		res.Msg = err.Error()
 		log.Warn("load frpc config file error: %s", res.Msg)
 		return
 	}
-	content := string(b)
 
-	for _, row := range strings.Split(content, "\n") {
-		row = strings.TrimSpace(row)
-		if strings.HasPrefix(row, "token") {
-			token = row
-			break
-		}
+	// rewrite the staged content line by line into the final temp file,
+	// dropping any submitted token rows and re-inserting the original token
+	// after [common]; renaming it into place at the end means a crash
+	// mid-write never leaves a half-written config behind
+	if _, err := staging.Seek(0, io.SeekStart); err != nil {
+		res.Code = 500
+		res.Msg = fmt.Sprintf("read temp config file error: %v", err)
+		log.Warn("%s", res.Msg)
+		return
 	}
-
-	tmpRows := make([]string, 0)
-	for _, row := range strings.Split(string(body), "\n") {
-		row = strings.TrimSpace(row)
+	tmpFile, err := ioutil.TempFile(filepath.Dir(svr.cfgFile), filepath.Base(svr.cfgFile)+".tmp")
+	if err != nil {
+		res.Code = 500
+		res.Msg = fmt.Sprintf("create temp config file error: %v", err)
+		log.Warn("%s", res.Msg)
+		return
+	}
+	tmpPath := tmpFile.Name()
+	bw := bufio.NewWriter(tmpFile)
+	scanner := bufio.NewScanner(staging)
+	first := true
+	for scanner.Scan() {
+		row := strings.TrimSpace(scanner.Text())
 		if strings.HasPrefix(row, "token") {
 			continue
 		}
-		tmpRows = append(tmpRows, row)
+		if !first {
+			bw.WriteString("\n")
+		}
+		first = false
+		bw.WriteString(row)
+		if token != "" && strings.HasPrefix(row, "[common]") {
+			bw.WriteString("\n")
+			bw.WriteString(token)
+		}
+	}
+	err = scanner.Err()
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		res.Code = 500
+		res.Msg = fmt.Sprintf("write content to frpc config file error: %v", err)
+		log.Warn("%s", res.Msg)
+		return
 	}
 
-	newRows := make([]string, 0)
-	if token != "" {
-		for _, row := range tmpRows {
-			newRows = append(newRows, row)
-			if strings.HasPrefix(row, "[common]") {
-				newRows = append(newRows, token)
-			}
+	// with ?validate=true, run the same pipeline as a reload against the new
+	// content first, so a broken config never reaches the file
+	if r.URL.Query().Get("validate") == "true" {
+		content, err := ioutil.ReadFile(tmpPath)
+		if err == nil {
+			err = config.ValidateClientConfigContent(content)
+		}
+		if err != nil {
+			os.Remove(tmpPath)
+			res.Code = 400
+			res.Msg = fmt.Sprintf("validate config content error: %v", err)
+			log.Warn("%s", res.Msg)
+			return
 		}
-	} else {
-		newRows = tmpRows
 	}
-	content = strings.Join(newRows, "\n")
 
-	err = ioutil.WriteFile(svr.cfgFile, []byte(content), 0644)
+	err = os.Chmod(tmpPath, 0644)
+	if err == nil {
+		err = os.Rename(tmpPath, svr.cfgFile)
+	}
 	if err != nil {
+		os.Remove(tmpPath)
 		res.Code = 500
 		res.Msg = fmt.Sprintf("write content to frpc config file error: %v", err)
 		log.Warn("%s", res.Msg)
 		return
 	}
 }
+
+// readConfigToken scans the current config file for its token row, so it can
+// be preserved across config uploads that omit it.
+func readConfigToken(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		row := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(row, "token") {
+			return row, nil
+		}
+	}
+	return "", scanner.Err()
+}
@@ -22,6 +22,7 @@ import (
 	"runtime/debug"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fatedier/frp/client/proxy"
@@ -78,6 +79,10 @@ type Control struct {
 	// The UDP port that the server is listening on
 	serverUDPPort int
 
+	// draining is set during a graceful stop; new work connection requests
+	// from the server are ignored while existing ones finish
+	draining uint32
+
 	mu sync.RWMutex
 
 	xl *xlog.Logger
@@ -133,8 +138,19 @@ func (ctl *Control) Run() {
 	return
 }
 
+// StartDraining makes the control ignore further work connection requests
+// from the server, so no new user traffic is accepted while in-flight work
+// connections finish.
+func (ctl *Control) StartDraining() {
+	atomic.StoreUint32(&ctl.draining, 1)
+}
+
 func (ctl *Control) HandleReqWorkConn(inMsg *msg.ReqWorkConn) {
 	xl := ctl.xl
+	if atomic.LoadUint32(&ctl.draining) != 0 {
+		xl.Debug("ignore ReqWorkConn message while draining")
+		return
+	}
 	workConn, err := ctl.connectServer()
 	if err != nil {
 		return
@@ -49,6 +49,10 @@ type Proxy interface {
 	// InWorkConn accept work connections registered to server.
 	InWorkConn(net.Conn, *msg.StartWorkConn)
 
+	// SetBandwidthLimit retunes the bandwidth limiter in place and reports
+	// whether the new limit is in effect.
+	SetBandwidthLimit(limitBytes int64) bool
+
 	Close()
 }
 
@@ -123,6 +127,22 @@ type BaseProxy struct {
 	ctx context.Context
 }
 
+// SetBandwidthLimit adjusts the bandwidth limiter of a running proxy without
+// touching its connections. A limiter can only be retuned after the proxy
+// has been created, not added or removed, so those cases report false and
+// need a regular reload.
+func (pxy *BaseProxy) SetBandwidthLimit(limitBytes int64) bool {
+	if pxy.limiter == nil {
+		return limitBytes <= 0
+	}
+	if limitBytes <= 0 {
+		return false
+	}
+	pxy.limiter.SetLimit(rate.Limit(float64(limitBytes)))
+	pxy.limiter.SetBurst(int(limitBytes))
+	return true
+}
+
 // TCP
 type TCPProxy struct {
 	*BaseProxy
@@ -55,6 +55,19 @@ func (pm *Manager) StartProxy(name string, remoteAddr string, serverRespErr stri
 	return nil
 }
 
+// SetProxyBandwidth retunes the bandwidth limiter of the named proxy in
+// place. It reports false when the proxy exists but the new limit can't be
+// applied without a restart.
+func (pm *Manager) SetProxyBandwidth(name string, limit config.BandwidthQuantity) (bool, error) {
+	pm.mu.RLock()
+	pxy, ok := pm.proxies[name]
+	pm.mu.RUnlock()
+	if !ok {
+		return false, fmt.Errorf("proxy [%s] not found", name)
+	}
+	return pxy.SetBandwidthLimit(limit), nil
+}
+
 func (pm *Manager) Close() {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
@@ -102,6 +115,18 @@ func (pm *Manager) GetAllProxyStatus() []*WorkingStatus {
 	return ps
 }
 
+// GetProxyStatusHistory returns the recorded phase transitions of one proxy,
+// oldest first.
+func (pm *Manager) GetProxyStatusHistory(name string) ([]StatusTransition, bool) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	pxy, ok := pm.proxies[name]
+	if !ok {
+		return nil, false
+	}
+	return pxy.GetStatusHistory(), true
+}
+
 func (pm *Manager) Reload(pxyCfgs map[string]config.ProxyConf) {
 	xl := xlog.FromContextSafe(pm.ctx)
 	pm.mu.Lock()
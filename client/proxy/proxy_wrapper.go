@@ -15,6 +15,7 @@ import (
 	"github.com/fatedier/frp/pkg/util/xlog"
 
 	"github.com/fatedier/golib/errors"
+	"golang.org/x/time/rate"
 )
 
 const (
@@ -32,6 +33,18 @@ var (
 	startErrTimeout                   = 30 * time.Second
 )
 
+// statusHistorySize bounds how many phase transitions are kept per proxy;
+// older entries are dropped.
+const statusHistorySize = 50
+
+// StatusTransition is one phase change of a proxy, kept in the status
+// history ring buffer.
+type StatusTransition struct {
+	Phase string    `json:"status"`
+	Err   string    `json:"err"`
+	Time  time.Time `json:"time"`
+}
+
 type WorkingStatus struct {
 	Name  string           `json:"name"`
 	Type  string           `json:"type"`
@@ -41,6 +54,10 @@ type WorkingStatus struct {
 
 	// Got from server.
 	RemoteAddr string `json:"remote_addr"`
+
+	// ThrottledConns is the number of work connections rejected by the
+	// accept rate limiter.
+	ThrottledConns uint64 `json:"throttled_conns"`
 }
 
 type Wrapper struct {
@@ -53,9 +70,17 @@ type Wrapper struct {
 	// monitor will watch if it is alive
 	monitor *health.Monitor
 
+	// if ProxyConf has an accept rate limit, work connections beyond the
+	// limit are rejected before they reach the local service
+	limiter        *rate.Limiter
+	throttledConns uint64
+
 	// event handler
 	handler event.Handler
 
+	// history keeps the most recent phase transitions, oldest first
+	history []StatusTransition
+
 	health           uint32
 	lastSendStartMsg time.Time
 	lastStartErr     time.Time
@@ -84,6 +109,15 @@ func NewWrapper(ctx context.Context, cfg config.ProxyConf, clientCfg config.Clie
 		ctx:            xlog.NewContext(ctx, xl),
 	}
 
+	if baseInfo.AcceptRateLimit > 0 {
+		burst := baseInfo.AcceptRateBurst
+		if burst < 1 {
+			burst = 1
+		}
+		pw.limiter = rate.NewLimiter(rate.Limit(baseInfo.AcceptRateLimit), burst)
+		xl.Trace("enable accept rate limit: %v conns/s, burst %d", baseInfo.AcceptRateLimit, burst)
+	}
+
 	if baseInfo.HealthCheckType != "" {
 		pw.health = 1 // means failed
 		pw.monitor = health.NewMonitor(pw.ctx, baseInfo.HealthCheckType, baseInfo.HealthCheckIntervalS,
@@ -93,9 +127,47 @@ func NewWrapper(ctx context.Context, cfg config.ProxyConf, clientCfg config.Clie
 	}
 
 	pw.pxy = NewProxy(pw.ctx, pw.Cfg, clientCfg, serverUDPPort)
+	pw.recordTransition()
 	return pw
 }
 
+// recordTransition appends the current phase to the status history, dropping
+// the oldest entry once the buffer is full. It must be called with the lock
+// held (or before the wrapper is shared).
+func (pw *Wrapper) recordTransition() {
+	pw.history = append(pw.history, StatusTransition{
+		Phase: pw.Phase,
+		Err:   pw.Err,
+		Time:  time.Now(),
+	})
+	if len(pw.history) > statusHistorySize {
+		pw.history = pw.history[len(pw.history)-statusHistorySize:]
+	}
+}
+
+// GetStatusHistory returns a copy of the recorded phase transitions, oldest
+// first.
+func (pw *Wrapper) GetStatusHistory() []StatusTransition {
+	pw.mu.RLock()
+	defer pw.mu.RUnlock()
+	history := make([]StatusTransition, len(pw.history))
+	copy(history, pw.history)
+	return history
+}
+
+// SetBandwidthLimit applies a new bandwidth limit to the running proxy
+// without restarting it. On success the wrapper's config is updated as well,
+// so a later reload doesn't see a spurious diff and tear the proxy down.
+func (pw *Wrapper) SetBandwidthLimit(limit config.BandwidthQuantity) bool {
+	if !pw.pxy.SetBandwidthLimit(limit.Bytes()) {
+		return false
+	}
+	pw.mu.Lock()
+	pw.Cfg.GetBaseInfo().BandwidthLimit = limit
+	pw.mu.Unlock()
+	return true
+}
+
 func (pw *Wrapper) SetRunningStatus(remoteAddr string, respErr string) error {
 	pw.mu.Lock()
 	defer pw.mu.Unlock()
@@ -108,6 +180,7 @@ func (pw *Wrapper) SetRunningStatus(remoteAddr string, respErr string) error {
 		pw.Phase = ProxyPhaseStartErr
 		pw.Err = respErr
 		pw.lastStartErr = time.Now()
+		pw.recordTransition()
 		return fmt.Errorf(pw.Err)
 	}
 
@@ -116,11 +189,13 @@ func (pw *Wrapper) SetRunningStatus(remoteAddr string, respErr string) error {
 		pw.Phase = ProxyPhaseStartErr
 		pw.Err = err.Error()
 		pw.lastStartErr = time.Now()
+		pw.recordTransition()
 		return err
 	}
 
 	pw.Phase = ProxyPhaseRunning
 	pw.Err = ""
+	pw.recordTransition()
 	return nil
 }
 
@@ -141,6 +216,7 @@ func (pw *Wrapper) Stop() {
 		pw.monitor.Stop()
 	}
 	pw.Phase = ProxyPhaseClosed
+	pw.recordTransition()
 	pw.close()
 }
 
@@ -170,6 +246,7 @@ func (pw *Wrapper) checkWorker() {
 
 				xl.Trace("change status from [%s] to [%s]", pw.Phase, ProxyPhaseWaitStart)
 				pw.Phase = ProxyPhaseWaitStart
+				pw.recordTransition()
 
 				var newProxyMsg msg.NewProxy
 				pw.Cfg.MarshalToMsg(&newProxyMsg)
@@ -185,6 +262,7 @@ func (pw *Wrapper) checkWorker() {
 				pw.close()
 				xl.Trace("change status from [%s] to [%s]", pw.Phase, ProxyPhaseCheckFailed)
 				pw.Phase = ProxyPhaseCheckFailed
+				pw.recordTransition()
 			}
 			pw.mu.Unlock()
 		}
@@ -224,6 +302,12 @@ func (pw *Wrapper) statusFailedCallback() {
 
 func (pw *Wrapper) InWorkConn(workConn net.Conn, m *msg.StartWorkConn) {
 	xl := pw.xl
+	if pw.limiter != nil && !pw.limiter.Allow() {
+		atomic.AddUint64(&pw.throttledConns, 1)
+		xl.Warn("work connection exceeds accept rate limit, rejected")
+		workConn.Close()
+		return
+	}
 	pw.mu.RLock()
 	pxy := pw.pxy
 	pw.mu.RUnlock()
@@ -239,12 +323,13 @@ func (pw *Wrapper) GetStatus() *WorkingStatus {
 	pw.mu.RLock()
 	defer pw.mu.RUnlock()
 	ps := &WorkingStatus{
-		Name:       pw.Name,
-		Type:       pw.Type,
-		Phase:      pw.Phase,
-		Err:        pw.Err,
-		Cfg:        pw.Cfg,
-		RemoteAddr: pw.RemoteAddr,
+		Name:           pw.Name,
+		Type:           pw.Type,
+		Phase:          pw.Phase,
+		Err:            pw.Err,
+		Cfg:            pw.Cfg,
+		RemoteAddr:     pw.RemoteAddr,
+		ThrottledConns: atomic.LoadUint64(&pw.throttledConns),
 	}
 	return ps
 }
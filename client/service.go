@@ -16,13 +16,16 @@ package client
 
 import (
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"runtime"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -61,9 +64,37 @@ type Service struct {
 	// string if no configuration file was used.
 	cfgFile string
 
+	// lastCfgFileHash is the content hash of the config file as of the last
+	// successfully applied reload, guarded by cfgMu. It lets polling-based
+	// reload calls skip the work when the file hasn't changed on disk.
+	lastCfgFileHash string
+
+	// store persists proxies and visitors managed through the admin API, or
+	// nil if no store_file is configured. storeMu serializes mutations and
+	// the reload that follows them.
+	store   *config.StoreSource
+	storeMu sync.Mutex
+	// storePrevSnapshot is the store state before the most recent successful
+	// mutation, guarded by storeMu; nil until the first mutation.
+	storePrevSnapshot *config.StoreSnapshot
+
+	// reloading is 1 while a configuration reload is executing, so the admin
+	// API can report it without blocking on the reload itself.
+	reloading int32
+	// lastReloadTime is the unix timestamp (seconds) of the last successful
+	// reload, or 0 if no reload happened yet.
+	lastReloadTime int64
+
 	// This is configured by the login response from frps
 	serverUDPPort int
 
+	// candidate server addresses in "host:port" format and in priority
+	// order, built from the common configuration; it has at least one element
+	serverAddrs []string
+	// index in serverAddrs of the server currently in use
+	serverAddrIdx int
+	serverAddrMu  sync.RWMutex
+
 	exit uint32 // 0 means not exit
 
 	// service context
@@ -75,19 +106,118 @@ type Service struct {
 func NewService(cfg config.ClientCommonConf, pxyCfgs map[string]config.ProxyConf, visitorCfgs map[string]config.VisitorConf, cfgFile string) (svr *Service, err error) {
 
 	ctx, cancel := context.WithCancel(context.Background())
+	serverAddrs := cfg.ServerAddrs
+	if len(serverAddrs) == 0 {
+		serverAddrs = []string{net.JoinHostPort(cfg.ServerAddr, strconv.Itoa(cfg.ServerPort))}
+	}
 	svr = &Service{
 		authSetter:  auth.NewAuthSetter(cfg.ClientConfig),
 		cfg:         cfg,
 		cfgFile:     cfgFile,
 		pxyCfgs:     pxyCfgs,
 		visitorCfgs: visitorCfgs,
+		serverAddrs: serverAddrs,
 		exit:        0,
 		ctx:         xlog.NewContext(ctx, xlog.New()),
 		cancel:      cancel,
 	}
+
+	if cfg.StoreFile != "" {
+		if cfg.StoreRemoteURL != "" {
+			svr.store, err = config.NewStoreSourceFromRemote(cfg.StoreFile, cfg.StoreRemoteURL)
+		} else {
+			svr.store, err = config.NewStoreSource(cfg.StoreFile)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("load store file error: %v", err)
+		}
+		svr.store.SetRenderEnvs(cfg.StoreRenderEnvs)
+		storePxyCfgs, errRet := svr.store.BuildProxyConfs(cfg.User)
+		if errRet != nil {
+			return nil, errRet
+		}
+		storeVisitorCfgs, errRet := svr.store.BuildVisitorConfs(cfg.User)
+		if errRet != nil {
+			return nil, errRet
+		}
+		for name, cfg := range storePxyCfgs {
+			svr.pxyCfgs[name] = cfg
+		}
+		for name, cfg := range storeVisitorCfgs {
+			svr.visitorCfgs[name] = cfg
+		}
+	}
 	return
 }
 
+// currentServerAddr returns the server address the client is currently
+// using to connect to frps.
+func (svr *Service) currentServerAddr() string {
+	svr.serverAddrMu.RLock()
+	defer svr.serverAddrMu.RUnlock()
+	return svr.serverAddrs[svr.serverAddrIdx]
+}
+
+// nextServerAddr advances to the next candidate server address, cycling
+// through the configured list. With a single configured server it is a no-op.
+func (svr *Service) nextServerAddr() {
+	svr.serverAddrMu.Lock()
+	defer svr.serverAddrMu.Unlock()
+	svr.serverAddrIdx = (svr.serverAddrIdx + 1) % len(svr.serverAddrs)
+}
+
+// resetServerAddr makes the next login attempt start from the
+// highest-priority address again. It runs at the start of every reconnect
+// round, so a recovered primary is re-preferred instead of the client
+// sticking with a backup forever.
+func (svr *Service) resetServerAddr() {
+	svr.serverAddrMu.Lock()
+	defer svr.serverAddrMu.Unlock()
+	svr.serverAddrIdx = 0
+}
+
+// fallbackToPrimaryServer periodically probes the highest-priority server
+// while the client is connected to a lower-priority one, and closes the
+// current control connection once the primary is reachable again so the
+// reconnect logic moves back to it. The probe is a plain TCP dial, so with
+// protocol = kcp it never succeeds and failback only happens on the next
+// reconnect.
+func (svr *Service) fallbackToPrimaryServer() {
+	xl := xlog.FromContextSafe(svr.ctx)
+	for {
+		select {
+		case <-svr.ctx.Done():
+			return
+		case <-time.After(60 * time.Second):
+		}
+		if atomic.LoadUint32(&svr.exit) != 0 {
+			return
+		}
+
+		svr.serverAddrMu.RLock()
+		idx := svr.serverAddrIdx
+		primary := svr.serverAddrs[0]
+		svr.serverAddrMu.RUnlock()
+		if idx == 0 {
+			continue
+		}
+
+		conn, err := net.DialTimeout("tcp", primary, 5*time.Second)
+		if err != nil {
+			continue
+		}
+		conn.Close()
+
+		xl.Info("primary server [%s] is reachable again, switching back", primary)
+		svr.ctlMu.RLock()
+		ctl := svr.ctl
+		svr.ctlMu.RUnlock()
+		if ctl != nil {
+			ctl.Close()
+		}
+	}
+}
+
 func (svr *Service) GetController() *Control {
 	svr.ctlMu.RLock()
 	defer svr.ctlMu.RUnlock()
@@ -121,20 +251,28 @@ func (svr *Service) Run() error {
 	}
 
 	go svr.keepControllerWorking()
+	if len(svr.serverAddrs) > 1 {
+		go svr.fallbackToPrimaryServer()
+	}
 
-	if svr.cfg.AdminPort != 0 {
+	// admin_addr = unix:///path binds the admin API to a unix domain socket
+	// instead of TCP; admin_port is ignored in that case
+	if svr.cfg.AdminPort != 0 || strings.HasPrefix(svr.cfg.AdminAddr, "unix://") {
 		// Init admin server assets
 		err := assets.Load(svr.cfg.AssetsDir)
 		if err != nil {
 			return fmt.Errorf("Load assets error: %v", err)
 		}
 
-		address := net.JoinHostPort(svr.cfg.AdminAddr, strconv.Itoa(svr.cfg.AdminPort))
+		address := svr.cfg.AdminAddr
+		if !strings.HasPrefix(address, "unix://") {
+			address = net.JoinHostPort(svr.cfg.AdminAddr, strconv.Itoa(svr.cfg.AdminPort))
+		}
 		err = svr.RunAdminServer(address)
 		if err != nil {
 			log.Warn("run admin server error: %v", err)
 		}
-		log.Info("admin server listen on %s:%d", svr.cfg.AdminAddr, svr.cfg.AdminPort)
+		log.Info("admin server listen on %s", address)
 	}
 	<-svr.ctx.Done()
 	return nil
@@ -158,6 +296,10 @@ func (svr *Service) keepControllerWorking() {
 			return
 		}
 
+		// each reconnect round starts from the highest-priority server;
+		// login failures then cycle through the rest of the list
+		svr.resetServerAddr()
+
 		// the first three retry with no delay
 		if reconnectCounts > 3 {
 			time.Sleep(reconnectDelay)
@@ -213,11 +355,13 @@ func (svr *Service) keepControllerWorking() {
 // session: if it's not nil, using tcp mux
 func (svr *Service) login() (conn net.Conn, session *fmux.Session, err error) {
 	xl := xlog.FromContextSafe(svr.ctx)
+	address := svr.currentServerAddr()
+
 	var tlsConfig *tls.Config
 	if svr.cfg.TLSEnable {
 		sn := svr.cfg.TLSServerName
 		if sn == "" {
-			sn = svr.cfg.ServerAddr
+			sn, _, _ = net.SplitHostPort(address)
 		}
 
 		tlsConfig, err = transport.NewClientTLSConfig(
@@ -231,9 +375,11 @@ func (svr *Service) login() (conn net.Conn, session *fmux.Session, err error) {
 		}
 	}
 
-	address := net.JoinHostPort(svr.cfg.ServerAddr, strconv.Itoa(svr.cfg.ServerPort))
 	conn, err = frpNet.ConnectServerByProxyWithTLS(svr.cfg.HTTPProxy, svr.cfg.Protocol, address, tlsConfig)
 	if err != nil {
+		// the current server is unreachable, fail over to the next
+		// candidate for the following attempt
+		svr.nextServerAddr()
 		return
 	}
 
@@ -306,12 +452,140 @@ func (svr *Service) login() (conn net.Conn, session *fmux.Session, err error) {
 }
 
 func (svr *Service) ReloadConf(pxyCfgs map[string]config.ProxyConf, visitorCfgs map[string]config.VisitorConf) error {
+	atomic.StoreInt32(&svr.reloading, 1)
+	defer atomic.StoreInt32(&svr.reloading, 0)
+
 	svr.cfgMu.Lock()
 	svr.pxyCfgs = pxyCfgs
 	svr.visitorCfgs = visitorCfgs
 	svr.cfgMu.Unlock()
 
-	return svr.ctl.ReloadConf(pxyCfgs, visitorCfgs)
+	err := svr.ctl.ReloadConf(pxyCfgs, visitorCfgs)
+	if err == nil {
+		atomic.StoreInt64(&svr.lastReloadTime, time.Now().Unix())
+	}
+	return err
+}
+
+// cfgFileHash returns the hex content hash of the config file, or an empty
+// string when no config file is in use or it can't be read. An empty hash
+// never matches, so reloads proceed in those cases.
+func (svr *Service) cfgFileHash() string {
+	if svr.cfgFile == "" {
+		return ""
+	}
+	content, err := ioutil.ReadFile(svr.cfgFile)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// cfgFileUnchanged reports whether hash matches the config file content of
+// the last successfully applied reload.
+func (svr *Service) cfgFileUnchanged(hash string) bool {
+	svr.cfgMu.RLock()
+	defer svr.cfgMu.RUnlock()
+	return hash != "" && hash == svr.lastCfgFileHash
+}
+
+// setCfgFileHash records the config file hash of a successfully applied
+// reload.
+func (svr *Service) setCfgFileHash(hash string) {
+	svr.cfgMu.Lock()
+	svr.lastCfgFileHash = hash
+	svr.cfgMu.Unlock()
+}
+
+// ErrProxyNotFound is returned by ReloadProxy when the named proxy doesn't
+// exist in any config source.
+var ErrProxyNotFound = errors.New("proxy not found in config sources")
+
+// ReloadProxy rebuilds the config set from all sources but applies only the
+// named proxy: it is restarted only if its config changed, and every other
+// proxy is left untouched. The name may be given with or without the user
+// prefix.
+func (svr *Service) ReloadProxy(name string) error {
+	pxyCfgs, _, err := svr.buildConfFromSources()
+	if err != nil {
+		return err
+	}
+
+	newCfg, ok := pxyCfgs[name]
+	if !ok {
+		name = config.FullProxyName(svr.cfg.User, name)
+		if newCfg, ok = pxyCfgs[name]; !ok {
+			return fmt.Errorf("proxy [%s]: %w", name, ErrProxyNotFound)
+		}
+	}
+
+	atomic.StoreInt32(&svr.reloading, 1)
+	defer atomic.StoreInt32(&svr.reloading, 0)
+
+	svr.cfgMu.Lock()
+	svr.pxyCfgs[name] = newCfg
+	cfgs := make(map[string]config.ProxyConf, len(svr.pxyCfgs))
+	for n, c := range svr.pxyCfgs {
+		cfgs[n] = c
+	}
+	svr.cfgMu.Unlock()
+
+	// the proxy manager only restarts entries whose config differs from the
+	// running one, so passing the full set with one entry refreshed touches
+	// at most that proxy
+	svr.ctl.pm.Reload(cfgs)
+	atomic.StoreInt64(&svr.lastReloadTime, time.Now().Unix())
+	return nil
+}
+
+// ReloadInProgress reports whether a configuration reload is currently
+// executing, along with the time of the last successful reload (zero time if
+// none happened yet).
+func (svr *Service) ReloadInProgress() (bool, time.Time) {
+	var last time.Time
+	if ts := atomic.LoadInt64(&svr.lastReloadTime); ts != 0 {
+		last = time.Unix(ts, 0)
+	}
+	return atomic.LoadInt32(&svr.reloading) == 1, last
+}
+
+// RuntimeConfig is a snapshot of the configuration the client is currently
+// running with, as opposed to the raw configuration file.
+type RuntimeConfig struct {
+	Common   config.ClientCommonConf       `json:"common"`
+	Proxies  map[string]config.ProxyConf   `json:"proxies"`
+	Visitors map[string]config.VisitorConf `json:"visitors"`
+}
+
+// GetRuntimeConfig returns a consistent copy of the running configuration.
+func (svr *Service) GetRuntimeConfig() RuntimeConfig {
+	svr.cfgMu.RLock()
+	defer svr.cfgMu.RUnlock()
+
+	rc := RuntimeConfig{
+		Common:   svr.cfg,
+		Proxies:  make(map[string]config.ProxyConf, len(svr.pxyCfgs)),
+		Visitors: make(map[string]config.VisitorConf, len(svr.visitorCfgs)),
+	}
+	for name, cfg := range svr.pxyCfgs {
+		rc.Proxies[name] = cfg
+	}
+	for name, cfg := range svr.visitorCfgs {
+		rc.Visitors[name] = cfg
+	}
+	return rc
+}
+
+// GracefulStop drains the service before closing it: new work connection
+// requests from the server are ignored right away, in-flight connections get
+// the timeout window to finish, then the control connection is torn down.
+func (svr *Service) GracefulStop(timeout time.Duration) {
+	if svr.ctl != nil {
+		svr.ctl.StartDraining()
+	}
+	time.Sleep(timeout)
+	svr.Close()
 }
 
 func (svr *Service) Close() {
@@ -0,0 +1,892 @@
+// Copyright 2021 The frp Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/fatedier/frp/pkg/config"
+	"github.com/fatedier/frp/pkg/consts"
+	"github.com/fatedier/frp/pkg/util/log"
+)
+
+var (
+	// ErrStoreDisabled is returned by store operations when no store_file is
+	// configured.
+	ErrStoreDisabled = errors.New("proxy store is disabled, set store_file to enable it")
+	// ErrApplyConfig is returned when a store mutation was valid but applying
+	// the resulting config failed; the mutation has been rolled back.
+	ErrApplyConfig = errors.New("apply config error")
+	// ErrBackendUnreachable is returned by TestStoreProxyBackend when the
+	// proxy's local backend could not be dialed.
+	ErrBackendUnreachable = errors.New("backend unreachable")
+)
+
+// validateStoreProxyConf checks that raw is a valid proxy config for this
+// client and returns its name.
+func validateStoreProxyConf(raw json.RawMessage) (string, error) {
+	var peek struct {
+		Name    string `json:"name"`
+		Type    string `json:"type"`
+		Enabled *bool  `json:"enabled"`
+	}
+	if err := json.Unmarshal(raw, &peek); err != nil {
+		return "", err
+	}
+	if peek.Name == "" {
+		return "", fmt.Errorf("proxy name shouldn't be empty")
+	}
+	// entries staged as disabled only need a valid name and type; full
+	// validation happens on the reload that enables them
+	if peek.Enabled != nil && !*peek.Enabled {
+		pxyType := peek.Type
+		if pxyType == "" {
+			pxyType = consts.TCPProxy
+		}
+		if config.NewConfByType(pxyType) == nil {
+			return "", fmt.Errorf("proxy type [%s] error", pxyType)
+		}
+		return peek.Name, nil
+	}
+	if _, err := config.NewProxyConfFromJSON(raw); err != nil {
+		return "", err
+	}
+	return peek.Name, nil
+}
+
+// validateStoreVisitorConf checks that raw is a valid visitor config for
+// this client and returns its name. Besides the base visitor validation it
+// enforces store_min_secret_key_length when configured.
+func (svr *Service) validateStoreVisitorConf(raw json.RawMessage) (string, error) {
+	var peek struct {
+		Name    string `json:"name"`
+		Type    string `json:"type"`
+		Enabled *bool  `json:"enabled"`
+	}
+	if err := json.Unmarshal(raw, &peek); err != nil {
+		return "", err
+	}
+	if peek.Name == "" {
+		return "", fmt.Errorf("visitor name shouldn't be empty")
+	}
+	// like proxies, disabled visitors are staged without full validation
+	if peek.Enabled != nil && !*peek.Enabled {
+		if config.DefaultVisitorConf(peek.Type) == nil {
+			return "", fmt.Errorf("visitor type [%s] error", peek.Type)
+		}
+		return peek.Name, nil
+	}
+	cfg, err := config.NewVisitorConfFromJSON(raw)
+	if err != nil {
+		return "", err
+	}
+	if minLen := svr.cfg.StoreMinSecretKeyLength; minLen > 0 && int64(len(cfg.GetBaseInfo().Sk)) < minLen {
+		return "", fmt.Errorf("visitor [%s] sk shouldn't be shorter than %d characters", peek.Name, minLen)
+	}
+	return peek.Name, nil
+}
+
+// withStoreMutationAndReload runs mutate against the store and reloads the
+// running config from all sources. If the mutate closure or the reload fails
+// the store is restored to its previous contents, so a mutation is either
+// fully applied or not at all — a multi-step closure that fails halfway has
+// already persisted its earlier steps.
+func (svr *Service) withStoreMutationAndReload(mutate func(s *config.StoreSource) error) error {
+	if svr.store == nil {
+		return ErrStoreDisabled
+	}
+	svr.storeMu.Lock()
+	defer svr.storeMu.Unlock()
+
+	snapshot := svr.store.Snapshot()
+	if err := mutate(svr.store); err != nil {
+		if restoreErr := svr.store.Restore(snapshot); restoreErr != nil {
+			return fmt.Errorf("%v (rollback failed: %v)", err, restoreErr)
+		}
+		return err
+	}
+	if err := svr.reloadConfFromSources(); err != nil {
+		if restoreErr := svr.store.Restore(snapshot); restoreErr != nil {
+			return fmt.Errorf("%w: %v (rollback failed: %v)", ErrApplyConfig, err, restoreErr)
+		}
+		return fmt.Errorf("%w: %v", ErrApplyConfig, err)
+	}
+	// keep the pre-mutation state around as the rollback target
+	svr.storePrevSnapshot = snapshot
+	return nil
+}
+
+// StoreWebhookEvent is the JSON payload POSTed to store_webhook_url after a
+// successful store mutation. Entity is "proxy" or "visitor" for single-entry
+// mutations, "group" for group-wide toggles, and "store" for whole-store
+// operations (replace, rollback), where Name is empty.
+type StoreWebhookEvent struct {
+	Entity    string `json:"entity"`
+	Name      string `json:"name"`
+	Operation string `json:"operation"`
+}
+
+// notifyStoreWebhook delivers a mutation event to the configured webhook
+// asynchronously; delivery failures are logged and never affect the caller.
+func (svr *Service) notifyStoreWebhook(entity, name, operation string) {
+	url := svr.cfg.StoreWebhookURL
+	if url == "" {
+		return
+	}
+	go func() {
+		buf, _ := json.Marshal(&StoreWebhookEvent{Entity: entity, Name: name, Operation: operation})
+		client := http.Client{Timeout: 10 * time.Second}
+		resp, err := client.Post(url, "application/json", bytes.NewReader(buf))
+		if err != nil {
+			log.Warn("store webhook delivery error: %v", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			log.Warn("store webhook returned status [%d]", resp.StatusCode)
+		}
+	}()
+}
+
+// RollbackStore restores the store to its state before the most recent
+// successful mutation. Only a single prior snapshot is kept; with none,
+// ErrStoreNotFound is returned.
+func (svr *Service) RollbackStore() error {
+	if svr.store == nil {
+		return ErrStoreDisabled
+	}
+	svr.storeMu.Lock()
+	defer svr.storeMu.Unlock()
+
+	if svr.storePrevSnapshot == nil {
+		return fmt.Errorf("no store mutation to roll back: %w", config.ErrStoreNotFound)
+	}
+
+	snapshot := svr.store.Snapshot()
+	if err := svr.store.Restore(svr.storePrevSnapshot); err != nil {
+		return err
+	}
+	if err := svr.reloadConfFromSources(); err != nil {
+		if restoreErr := svr.store.Restore(snapshot); restoreErr != nil {
+			return fmt.Errorf("%w: %v (rollback failed: %v)", ErrApplyConfig, err, restoreErr)
+		}
+		return fmt.Errorf("%w: %v", ErrApplyConfig, err)
+	}
+	// rolling back is itself a mutation, so a second call undoes the undo
+	svr.storePrevSnapshot = snapshot
+	svr.notifyStoreWebhook("store", "", "rollback")
+	return nil
+}
+
+// buildConfFromSources rebuilds the full proxy and visitor config set from
+// the configuration file (if any) plus the store. Store entries take
+// precedence over file entries with the same name.
+func (svr *Service) buildConfFromSources() (map[string]config.ProxyConf, map[string]config.VisitorConf, error) {
+	if svr.cfgFile == "" && svr.store == nil {
+		return nil, nil, fmt.Errorf("frpc has no config file path")
+	}
+
+	pxyCfgs := make(map[string]config.ProxyConf)
+	visitorCfgs := make(map[string]config.VisitorConf)
+
+	if svr.cfgFile != "" {
+		_, filePxyCfgs, fileVisitorCfgs, err := config.ParseClientConfig(svr.cfgFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		pxyCfgs = filePxyCfgs
+		visitorCfgs = fileVisitorCfgs
+	}
+
+	if svr.store != nil {
+		storePxyCfgs, err := svr.store.BuildProxyConfs(svr.cfg.User)
+		if err != nil {
+			return nil, nil, err
+		}
+		storeVisitorCfgs, err := svr.store.BuildVisitorConfs(svr.cfg.User)
+		if err != nil {
+			return nil, nil, err
+		}
+		for name, cfg := range storePxyCfgs {
+			pxyCfgs[name] = cfg
+		}
+		for name, cfg := range storeVisitorCfgs {
+			visitorCfgs[name] = cfg
+		}
+	}
+	return pxyCfgs, visitorCfgs, nil
+}
+
+// reloadConfFromSources rebuilds the config set from all sources and applies
+// it to the running client.
+func (svr *Service) reloadConfFromSources() error {
+	pxyCfgs, visitorCfgs, err := svr.buildConfFromSources()
+	if err != nil {
+		return err
+	}
+	return svr.ReloadConf(pxyCfgs, visitorCfgs)
+}
+
+// CreateStoreProxy adds a new proxy to the store. With ifNotExists set,
+// re-creating an entry whose normalized config matches the stored one is a
+// no-op instead of a conflict, so declarative scripts can re-apply safely.
+func (svr *Service) CreateStoreProxy(raw json.RawMessage, ifNotExists bool) error {
+	name, err := validateStoreProxyConf(raw)
+	if err != nil {
+		return err
+	}
+	if ifNotExists {
+		if entry, getErr := svr.GetStoreProxy(name); getErr == nil {
+			// compare the parsed configs so key order and runtime defaults
+			// don't cause spurious conflicts
+			existingCfg, err1 := config.NewProxyConfFromJSON(entry.Conf)
+			newCfg, err2 := config.NewProxyConfFromJSON(raw)
+			if err1 == nil && err2 == nil && existingCfg.Compare(newCfg) {
+				return nil
+			}
+			return fmt.Errorf("proxy [%s] already exists with a different config: %w", name, config.ErrStoreConflict)
+		}
+	}
+	if err := svr.withStoreMutationAndReload(func(s *config.StoreSource) error {
+		return s.AddProxy(name, raw)
+	}); err != nil {
+		return err
+	}
+	svr.notifyStoreWebhook("proxy", name, "create")
+	return nil
+}
+
+// BulkCreateStoreProxies validates all configs first and then adds them in
+// one transaction, so either all entries are committed or none. Conflicts
+// with entries already in the store are reported up front; a failure inside
+// the transaction is rolled back by the mutation helper either way.
+func (svr *Service) BulkCreateStoreProxies(raws []json.RawMessage) error {
+	if svr.store == nil {
+		return ErrStoreDisabled
+	}
+	names := make([]string, 0, len(raws))
+	seen := make(map[string]struct{})
+	for i, raw := range raws {
+		name, err := validateStoreProxyConf(raw)
+		if err != nil {
+			return fmt.Errorf("item %d: %v", i, err)
+		}
+		if _, ok := seen[name]; ok {
+			return fmt.Errorf("item %d: duplicated proxy name [%s]", i, name)
+		}
+		if _, ok := svr.store.GetProxy(name); ok {
+			return fmt.Errorf("item %d: proxy [%s] already exists: %w", i, name, config.ErrStoreConflict)
+		}
+		if _, ok := svr.store.GetVisitor(name); ok {
+			return fmt.Errorf("item %d: a visitor named [%s] already exists: %w", i, name, config.ErrStoreConflict)
+		}
+		seen[name] = struct{}{}
+		names = append(names, name)
+	}
+	if err := svr.withStoreMutationAndReload(func(s *config.StoreSource) error {
+		for i, raw := range raws {
+			if err := s.AddProxy(names[i], raw); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, name := range names {
+		svr.notifyStoreWebhook("proxy", name, "create")
+	}
+	return nil
+}
+
+// BulkCreateStoreProxiesBestEffort applies every valid entry and reports a
+// per-item outcome instead of failing the whole batch, committing the
+// successful entries with a single reload. A failed reload rolls everything
+// back and is reported on every otherwise-successful item.
+func (svr *Service) BulkCreateStoreProxiesBestEffort(raws []json.RawMessage) []error {
+	results := make([]error, len(raws))
+	names := make([]string, len(raws))
+	seen := make(map[string]int)
+	valid := 0
+	for i, raw := range raws {
+		name, err := validateStoreProxyConf(raw)
+		if err != nil {
+			results[i] = err
+			continue
+		}
+		if j, ok := seen[name]; ok {
+			results[i] = fmt.Errorf("duplicated proxy name [%s] with item %d", name, j)
+			continue
+		}
+		seen[name] = i
+		names[i] = name
+		valid++
+	}
+	if valid == 0 {
+		return results
+	}
+
+	err := svr.withStoreMutationAndReload(func(s *config.StoreSource) error {
+		for i, raw := range raws {
+			if results[i] != nil {
+				continue
+			}
+			// a per-item failure (e.g. a name conflict) doesn't abort the
+			// batch, it's just reported for that item
+			results[i] = s.AddProxy(names[i], raw)
+		}
+		return nil
+	})
+	if err != nil {
+		for i := range results {
+			if results[i] == nil {
+				results[i] = err
+			}
+		}
+		return results
+	}
+	for i := range results {
+		if results[i] == nil {
+			svr.notifyStoreWebhook("proxy", names[i], "create")
+		}
+	}
+	return results
+}
+
+// UpdateStoreProxy replaces a store proxy config. A non-zero
+// expectedRevision makes the update conditional: it fails with
+// config.ErrStoreRevisionMismatch if the entry changed since that revision.
+// ReplaceStore atomically replaces the whole store contents with the given
+// entries, deleting anything not present in the payload. All entries are
+// validated up front; on any failure the store is left untouched.
+func (svr *Service) ReplaceStore(proxies, visitors []json.RawMessage) error {
+	pxyNames := make([]string, 0, len(proxies))
+	seen := make(map[string]struct{})
+	for i, raw := range proxies {
+		name, err := validateStoreProxyConf(raw)
+		if err != nil {
+			return fmt.Errorf("proxy item %d: %v", i, err)
+		}
+		if _, ok := seen[name]; ok {
+			return fmt.Errorf("proxy item %d: duplicated proxy name [%s]", i, name)
+		}
+		seen[name] = struct{}{}
+		pxyNames = append(pxyNames, name)
+	}
+
+	// names are unique across proxies and visitors, so the seen map is
+	// shared; a cross-entity clash must fail here, before the old store is
+	// cleared
+	visitorNames := make([]string, 0, len(visitors))
+	for i, raw := range visitors {
+		name, err := svr.validateStoreVisitorConf(raw)
+		if err != nil {
+			return fmt.Errorf("visitor item %d: %v", i, err)
+		}
+		if _, ok := seen[name]; ok {
+			return fmt.Errorf("visitor item %d: name [%s] is already used in this payload", i, name)
+		}
+		seen[name] = struct{}{}
+		visitorNames = append(visitorNames, name)
+	}
+
+	if err := svr.withStoreMutationAndReload(func(s *config.StoreSource) error {
+		if err := s.RemoveAll(); err != nil {
+			return err
+		}
+		for i, raw := range proxies {
+			if err := s.AddProxy(pxyNames[i], raw); err != nil {
+				return err
+			}
+		}
+		for i, raw := range visitors {
+			if err := s.AddVisitor(visitorNames[i], raw); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	svr.notifyStoreWebhook("store", "", "replace")
+	return nil
+}
+
+func (svr *Service) UpdateStoreProxy(name string, raw json.RawMessage, expectedRevision uint64) error {
+	rawName, err := validateStoreProxyConf(raw)
+	if err != nil {
+		return err
+	}
+	if rawName != name {
+		return fmt.Errorf("proxy name in body [%s] doesn't match [%s]", rawName, name)
+	}
+	if err := svr.withStoreMutationAndReload(func(s *config.StoreSource) error {
+		return s.UpdateProxyWithRevision(name, raw, expectedRevision)
+	}); err != nil {
+		return err
+	}
+	svr.notifyStoreWebhook("proxy", name, "update")
+	return nil
+}
+
+// CloneStoreProxy duplicates a store proxy under a new name, copying the
+// stored config as submitted so placeholders and secret references stay
+// references in the copy.
+func (svr *Service) CloneStoreProxy(name, newName string) error {
+	if newName == "" {
+		return fmt.Errorf("newName shouldn't be empty")
+	}
+	entry, err := svr.GetStoreProxy(name)
+	if err != nil {
+		return err
+	}
+
+	var obj map[string]interface{}
+	if err := json.Unmarshal(entry.Conf, &obj); err != nil {
+		return err
+	}
+	obj["name"] = newName
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	if _, err := validateStoreProxyConf(raw); err != nil {
+		return err
+	}
+
+	if err := svr.withStoreMutationAndReload(func(s *config.StoreSource) error {
+		return s.AddProxy(newName, raw)
+	}); err != nil {
+		return err
+	}
+	svr.notifyStoreWebhook("proxy", newName, "create")
+	return nil
+}
+
+func (svr *Service) RenameStoreProxy(oldName, newName string) error {
+	if newName == "" {
+		return fmt.Errorf("newName shouldn't be empty")
+	}
+	if err := svr.withStoreMutationAndReload(func(s *config.StoreSource) error {
+		return s.RenameProxy(oldName, newName)
+	}); err != nil {
+		return err
+	}
+	svr.notifyStoreWebhook("proxy", newName, "rename")
+	return nil
+}
+
+// SetStoreProxyEnabled flips a store proxy on or off without requiring the
+// full config body; disabled entries are kept in the store but not run.
+func (svr *Service) SetStoreProxyEnabled(name string, enabled bool) error {
+	if err := svr.withStoreMutationAndReload(func(s *config.StoreSource) error {
+		return s.SetProxyEnabled(name, enabled)
+	}); err != nil {
+		return err
+	}
+	svr.notifyStoreWebhook("proxy", name, "update")
+	return nil
+}
+
+// SetStoreProxyHealthCheckEnabled suppresses or restores a store proxy's
+// health check, leaving the rest of its config untouched.
+func (svr *Service) SetStoreProxyHealthCheckEnabled(name string, enabled bool) error {
+	if err := svr.withStoreMutationAndReload(func(s *config.StoreSource) error {
+		return s.SetProxyHealthCheckEnabled(name, enabled)
+	}); err != nil {
+		return err
+	}
+	svr.notifyStoreWebhook("proxy", name, "update")
+	return nil
+}
+
+// UpdateStoreProxyBandwidth changes only the bandwidth limit of a store
+// proxy. When the running proxy already has a limiter it is retuned in place
+// and the tunnel stays up; otherwise the change goes through the normal
+// update-and-reload path and the proxy is restarted.
+func (svr *Service) UpdateStoreProxyBandwidth(name, limit string) error {
+	quantity, err := config.NewBandwidthQuantity(limit)
+	if err != nil {
+		return fmt.Errorf("invalid bandwidth limit [%s]: %v", limit, err)
+	}
+	entry, err := svr.GetStoreProxy(name)
+	if err != nil {
+		return err
+	}
+
+	var obj map[string]interface{}
+	if err := json.Unmarshal(entry.Conf, &obj); err != nil {
+		return err
+	}
+	obj["bandwidth_limit"] = quantity.String()
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+
+	applied := false
+	if svr.ctl != nil {
+		fullName := config.FullProxyName(svr.cfg.User, name)
+		if ok, setErr := svr.ctl.pm.SetProxyBandwidth(fullName, quantity); setErr == nil && ok {
+			applied = true
+		}
+	}
+	if !applied {
+		return svr.UpdateStoreProxy(name, raw, entry.Revision)
+	}
+
+	// the running proxy already carries the new limit, so persist the store
+	// change without triggering a reload
+	if err := func() error {
+		svr.storeMu.Lock()
+		defer svr.storeMu.Unlock()
+		snapshot := svr.store.Snapshot()
+		if err := svr.store.UpdateProxyWithRevision(name, raw, entry.Revision); err != nil {
+			return err
+		}
+		svr.storePrevSnapshot = snapshot
+		return nil
+	}(); err != nil {
+		return err
+	}
+	svr.notifyStoreWebhook("proxy", name, "update")
+	return nil
+}
+
+// applyMergePatch applies an RFC 7386 JSON Merge Patch: object members are
+// merged recursively, null members delete the target key, and anything else
+// replaces the target value.
+func applyMergePatch(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = make(map[string]interface{})
+	}
+	for k, v := range patchObj {
+		if v == nil {
+			delete(targetObj, k)
+		} else {
+			targetObj[k] = applyMergePatch(targetObj[k], v)
+		}
+	}
+	return targetObj
+}
+
+// PatchStoreProxy applies a JSON Merge Patch to a stored proxy config, then
+// validates and persists the merged result. The entry revision read along
+// with the current config makes the update conditional, so a concurrent
+// change fails with config.ErrStoreRevisionMismatch instead of being lost.
+func (svr *Service) PatchStoreProxy(name string, patch []byte) error {
+	entry, err := svr.GetStoreProxy(name)
+	if err != nil {
+		return err
+	}
+	var target, patchVal interface{}
+	if err := json.Unmarshal(entry.Conf, &target); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(patch, &patchVal); err != nil {
+		return fmt.Errorf("invalid merge patch: %v", err)
+	}
+	if _, ok := patchVal.(map[string]interface{}); !ok {
+		return fmt.Errorf("merge patch should be a JSON object")
+	}
+	merged, err := json.Marshal(applyMergePatch(target, patchVal))
+	if err != nil {
+		return err
+	}
+	return svr.UpdateStoreProxy(name, merged, entry.Revision)
+}
+
+// ListStoreProxyGroups returns the distinct groups of the store proxies;
+// proxies without a "group" field belong to the default group.
+func (svr *Service) ListStoreProxyGroups() ([]string, error) {
+	if svr.store == nil {
+		return nil, ErrStoreDisabled
+	}
+	return svr.store.GetProxyGroups(), nil
+}
+
+// SetStoreProxyGroupEnabled flips every proxy of a group on or off in one
+// transaction.
+func (svr *Service) SetStoreProxyGroupEnabled(group string, enabled bool) error {
+	if err := svr.withStoreMutationAndReload(func(s *config.StoreSource) error {
+		return s.SetGroupEnabled(group, enabled)
+	}); err != nil {
+		return err
+	}
+	svr.notifyStoreWebhook("group", group, "update")
+	return nil
+}
+
+// DeleteStoreProxy removes a proxy from the store. With force set, a failed
+// reload after the deletion is logged but doesn't roll the deletion back,
+// which is what you want when the proxy being removed is itself what breaks
+// the reload.
+func (svr *Service) DeleteStoreProxy(name string, force bool) error {
+	if !force {
+		if err := svr.withStoreMutationAndReload(func(s *config.StoreSource) error {
+			return s.RemoveProxy(name)
+		}); err != nil {
+			return err
+		}
+		svr.notifyStoreWebhook("proxy", name, "delete")
+		return nil
+	}
+
+	if svr.store == nil {
+		return ErrStoreDisabled
+	}
+	svr.storeMu.Lock()
+	defer svr.storeMu.Unlock()
+
+	snapshot := svr.store.Snapshot()
+	if err := svr.store.RemoveProxy(name); err != nil {
+		return err
+	}
+	if err := svr.reloadConfFromSources(); err != nil {
+		log.Warn("force delete store proxy [%s]: reload error ignored: %v", name, err)
+	}
+	svr.storePrevSnapshot = snapshot
+	svr.notifyStoreWebhook("proxy", name, "delete")
+	return nil
+}
+
+func (svr *Service) GetStoreProxy(name string) (config.StoreProxyEntry, error) {
+	if svr.store == nil {
+		return config.StoreProxyEntry{}, ErrStoreDisabled
+	}
+	entry, ok := svr.store.GetProxyEntry(name)
+	if !ok {
+		return config.StoreProxyEntry{}, fmt.Errorf("proxy [%s]: %w", name, config.ErrStoreNotFound)
+	}
+	return entry, nil
+}
+
+// storeBackendDialTimeout bounds the connectivity probe in
+// TestStoreProxyBackend.
+var storeBackendDialTimeout = 3 * time.Second
+
+// TestStoreProxyBackend dials a store proxy's local backend once and reports
+// whether it is reachable and how long the dial took. The running tunnel is
+// not touched. Proxies served by a plugin have no backend address to test.
+func (svr *Service) TestStoreProxyBackend(name string) (reachable bool, latency time.Duration, err error) {
+	entry, err := svr.GetStoreProxy(name)
+	if err != nil {
+		return false, 0, err
+	}
+	cfg, err := config.NewProxyConfFromJSON(entry.Conf)
+	if err != nil {
+		return false, 0, err
+	}
+	base := cfg.GetBaseInfo()
+	if base.Plugin != "" {
+		return false, 0, fmt.Errorf("proxy [%s] uses plugin [%s] and has no backend address", name, base.Plugin)
+	}
+
+	addr := net.JoinHostPort(base.LocalIP, strconv.Itoa(base.LocalPort))
+	start := time.Now()
+	conn, dialErr := net.DialTimeout("tcp", addr, storeBackendDialTimeout)
+	if dialErr != nil {
+		return false, 0, fmt.Errorf("%w: %v", ErrBackendUnreachable, dialErr)
+	}
+	conn.Close()
+	return true, time.Since(start), nil
+}
+
+// StoreStats returns entry counts and backing-file statistics for the
+// store, for monitoring its growth.
+func (svr *Service) StoreStats() (config.StoreStats, error) {
+	if svr.store == nil {
+		return config.StoreStats{}, ErrStoreDisabled
+	}
+	return svr.store.Stats()
+}
+
+func (svr *Service) ListStoreProxies() ([]*config.StoreProxyEntry, error) {
+	if svr.store == nil {
+		return nil, ErrStoreDisabled
+	}
+	return svr.store.GetAllProxies(), nil
+}
+
+// ListStoreProxyNames returns only the sorted store proxy names, avoiding
+// the cost of serializing every config.
+func (svr *Service) ListStoreProxyNames() ([]string, error) {
+	if svr.store == nil {
+		return nil, ErrStoreDisabled
+	}
+	names := svr.store.GetAllProxyNames()
+	sort.Strings(names)
+	return names, nil
+}
+
+func (svr *Service) CreateStoreVisitor(raw json.RawMessage) error {
+	name, err := svr.validateStoreVisitorConf(raw)
+	if err != nil {
+		return err
+	}
+	if err := svr.withStoreMutationAndReload(func(s *config.StoreSource) error {
+		return s.AddVisitor(name, raw)
+	}); err != nil {
+		return err
+	}
+	svr.notifyStoreWebhook("visitor", name, "create")
+	return nil
+}
+
+func (svr *Service) UpdateStoreVisitor(name string, raw json.RawMessage) error {
+	rawName, err := svr.validateStoreVisitorConf(raw)
+	if err != nil {
+		return err
+	}
+	if rawName != name {
+		return fmt.Errorf("visitor name in body [%s] doesn't match [%s]", rawName, name)
+	}
+	if err := svr.withStoreMutationAndReload(func(s *config.StoreSource) error {
+		return s.UpdateVisitor(name, raw)
+	}); err != nil {
+		return err
+	}
+	svr.notifyStoreWebhook("visitor", name, "update")
+	return nil
+}
+
+func (svr *Service) DeleteStoreVisitor(name string) error {
+	if err := svr.withStoreMutationAndReload(func(s *config.StoreSource) error {
+		return s.RemoveVisitor(name)
+	}); err != nil {
+		return err
+	}
+	svr.notifyStoreWebhook("visitor", name, "delete")
+	return nil
+}
+
+func (svr *Service) GetStoreVisitor(name string) (json.RawMessage, error) {
+	if svr.store == nil {
+		return nil, ErrStoreDisabled
+	}
+	conf, ok := svr.store.GetVisitor(name)
+	if !ok {
+		return nil, fmt.Errorf("visitor [%s]: %w", name, config.ErrStoreNotFound)
+	}
+	return conf, nil
+}
+
+func (svr *Service) ListStoreVisitors() ([]*config.StoreVisitorEntry, error) {
+	if svr.store == nil {
+		return nil, ErrStoreDisabled
+	}
+	return svr.store.GetAllVisitors(), nil
+}
+
+// StoreDiff describes how the config rebuilt from all sources differs from
+// the currently running config, i.e. what a reload would change.
+type StoreDiff struct {
+	AddedProxies     []string `json:"added_proxies"`
+	RemovedProxies   []string `json:"removed_proxies"`
+	ModifiedProxies  []string `json:"modified_proxies"`
+	AddedVisitors    []string `json:"added_visitors"`
+	RemovedVisitors  []string `json:"removed_visitors"`
+	ModifiedVisitors []string `json:"modified_visitors"`
+}
+
+// DiffStore rebuilds the config set from all sources and compares it against
+// the running config without applying anything. Both sides are fully hydrated
+// configs, so runtime defaults never show up as spurious diffs.
+func (svr *Service) DiffStore() (*StoreDiff, error) {
+	if svr.store == nil {
+		return nil, ErrStoreDisabled
+	}
+	svr.storeMu.Lock()
+	pxyCfgs, visitorCfgs, err := svr.buildConfFromSources()
+	svr.storeMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &StoreDiff{
+		AddedProxies:     make([]string, 0),
+		RemovedProxies:   make([]string, 0),
+		ModifiedProxies:  make([]string, 0),
+		AddedVisitors:    make([]string, 0),
+		RemovedVisitors:  make([]string, 0),
+		ModifiedVisitors: make([]string, 0),
+	}
+
+	svr.cfgMu.RLock()
+	defer svr.cfgMu.RUnlock()
+	for name, cfg := range pxyCfgs {
+		if oldCfg, ok := svr.pxyCfgs[name]; !ok {
+			diff.AddedProxies = append(diff.AddedProxies, name)
+		} else if !oldCfg.Compare(cfg) {
+			diff.ModifiedProxies = append(diff.ModifiedProxies, name)
+		}
+	}
+	for name := range svr.pxyCfgs {
+		if _, ok := pxyCfgs[name]; !ok {
+			diff.RemovedProxies = append(diff.RemovedProxies, name)
+		}
+	}
+	for name, cfg := range visitorCfgs {
+		if oldCfg, ok := svr.visitorCfgs[name]; !ok {
+			diff.AddedVisitors = append(diff.AddedVisitors, name)
+		} else if !oldCfg.Compare(cfg) {
+			diff.ModifiedVisitors = append(diff.ModifiedVisitors, name)
+		}
+	}
+	for name := range svr.visitorCfgs {
+		if _, ok := visitorCfgs[name]; !ok {
+			diff.RemovedVisitors = append(diff.RemovedVisitors, name)
+		}
+	}
+
+	sort.Strings(diff.AddedProxies)
+	sort.Strings(diff.RemovedProxies)
+	sort.Strings(diff.ModifiedProxies)
+	sort.Strings(diff.AddedVisitors)
+	sort.Strings(diff.RemovedVisitors)
+	sort.Strings(diff.ModifiedVisitors)
+	return diff, nil
+}
+
+// ExportStore serializes the whole store into a single document. Supported
+// formats are "ini", matching the frpc config file layout, and "json",
+// matching the payloads accepted by the store endpoints. Entries are
+// exported exactly as submitted, without injecting runtime defaults.
+func (svr *Service) ExportStore(format string) ([]byte, error) {
+	if svr.store == nil {
+		return nil, ErrStoreDisabled
+	}
+	switch format {
+	case "json":
+		return svr.store.ExportJSON()
+	case "", "ini":
+		return svr.store.ExportIni()
+	default:
+		return nil, fmt.Errorf("unsupported export format [%s]", format)
+	}
+}
@@ -0,0 +1,1145 @@
+// Copyright 2021 The frp Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fatedier/frp/pkg/config"
+	"github.com/fatedier/frp/pkg/consts"
+	"github.com/fatedier/frp/pkg/util/log"
+
+	"github.com/gorilla/mux"
+)
+
+// storeErrorStatus maps errors from the store operations to HTTP status
+// codes.
+func storeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, config.ErrStoreNotFound):
+		return 404
+	case errors.Is(err, config.ErrStoreConflict):
+		return 409
+	case errors.Is(err, config.ErrStoreRevisionMismatch):
+		return 412
+	case errors.Is(err, ErrApplyConfig):
+		return 500
+	default:
+		return 400
+	}
+}
+
+// storeErrorCode maps errors from the store operations to stable
+// machine-readable codes, so API clients can switch on them instead of
+// parsing English text.
+func storeErrorCode(err error) string {
+	switch {
+	case errors.Is(err, config.ErrStoreNotFound):
+		return "STORE_NOT_FOUND"
+	case errors.Is(err, config.ErrStoreConflict):
+		return "STORE_CONFLICT"
+	case errors.Is(err, config.ErrStoreRevisionMismatch):
+		return "REVISION_MISMATCH"
+	case errors.Is(err, ErrStoreDisabled):
+		return "STORE_DISABLED"
+	case errors.Is(err, ErrApplyConfig):
+		return "APPLY_CONFIG_FAILED"
+	default:
+		return "INVALID_ARGUMENT"
+	}
+}
+
+// StoreErrorResp is the structured body of store API error responses.
+type StoreErrorResp struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// storeErrorBody renders an error as a structured JSON body; the HTTP status
+// mapping in storeErrorStatus is unchanged.
+func storeErrorBody(err error) string {
+	buf, _ := json.Marshal(&StoreErrorResp{Code: storeErrorCode(err), Message: err.Error()})
+	return string(buf)
+}
+
+// parseIfMatchRevision extracts an entry revision from the If-Match header;
+// 0 means the header is absent and the update is unconditional.
+func parseIfMatchRevision(r *http.Request) (uint64, error) {
+	etag := r.Header.Get("If-Match")
+	if etag == "" || etag == "*" {
+		return 0, nil
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	etag = strings.Trim(etag, `"`)
+	revision, err := strconv.ParseUint(etag, 10, 64)
+	if err != nil || revision == 0 {
+		return 0, fmt.Errorf("invalid If-Match header [%s]", r.Header.Get("If-Match"))
+	}
+	return revision, nil
+}
+
+func readStoreRequestBody(r *http.Request) (json.RawMessage, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read request body error: %v", err)
+	}
+	if len(body) == 0 {
+		return nil, fmt.Errorf("body can't be empty")
+	}
+	return body, nil
+}
+
+// canonicalJSON re-marshals a raw config through an interface{} so object
+// keys come out sorted, giving byte-stable list/get responses regardless of
+// the key order the config was submitted with. Anything that fails to parse
+// is returned unchanged.
+func canonicalJSON(raw json.RawMessage) json.RawMessage {
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return raw
+	}
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return raw
+	}
+	return buf
+}
+
+// GET api/store/stats
+func (svr *Service) apiStoreStats(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+
+	log.Info("Http request [/api/store/stats]")
+	defer func() {
+		log.Info("Http response [/api/store/stats], code [%d]", res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+
+	stats, err := svr.StoreStats()
+	if err != nil {
+		res.Code = storeErrorStatus(err)
+		res.Msg = storeErrorBody(err)
+		return
+	}
+	buf, _ := json.Marshal(&stats)
+	res.Msg = string(buf)
+}
+
+// POST api/store/proxies
+func (svr *Service) apiCreateStoreProxy(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+
+	log.Info("Http request [/api/store/proxies]")
+	defer func() {
+		log.Info("Http response [/api/store/proxies], code [%d]", res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+
+	body, err := readStoreRequestBody(r)
+	if err != nil {
+		res.Code = 400
+		res.Msg = err.Error()
+		return
+	}
+
+	ifNotExists := r.URL.Query().Get("ifNotExists") == "true"
+	if err := svr.CreateStoreProxy(body, ifNotExists); err != nil {
+		res.Code = storeErrorStatus(err)
+		res.Msg = storeErrorBody(err)
+		log.Warn("create store proxy error: %s", res.Msg)
+		return
+	}
+}
+
+type BulkCreateItemError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+type BulkCreateResp struct {
+	Created int                   `json:"created"`
+	Errors  []BulkCreateItemError `json:"errors,omitempty"`
+}
+
+// ReplaceStoreReq is the payload of PUT /api/store: the full desired store
+// state, replacing whatever is currently stored.
+type ReplaceStoreReq struct {
+	Proxies  []json.RawMessage `json:"proxies"`
+	Visitors []json.RawMessage `json:"visitors"`
+}
+
+// POST /api/store/rollback
+func (svr *Service) apiRollbackStore(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+
+	log.Info("Http request [/api/store/rollback]")
+	defer func() {
+		log.Info("Http response [/api/store/rollback], code [%d]", res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+
+	if err := svr.RollbackStore(); err != nil {
+		res.Code = storeErrorStatus(err)
+		res.Msg = storeErrorBody(err)
+		log.Warn("rollback store error: %s", res.Msg)
+		return
+	}
+}
+
+// PUT /api/store
+func (svr *Service) apiReplaceStore(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+
+	log.Info("Http put request [/api/store]")
+	defer func() {
+		log.Info("Http put response [/api/store], code [%d]", res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+
+	body, err := readStoreRequestBody(r)
+	if err != nil {
+		res.Code = 400
+		res.Msg = err.Error()
+		return
+	}
+
+	var req ReplaceStoreReq
+	if err := json.Unmarshal(body, &req); err != nil {
+		res.Code = 400
+		res.Msg = fmt.Sprintf("request body should be a JSON object with proxies and visitors arrays: %v", err)
+		return
+	}
+
+	if err := svr.ReplaceStore(req.Proxies, req.Visitors); err != nil {
+		res.Code = storeErrorStatus(err)
+		res.Msg = storeErrorBody(err)
+		log.Warn("replace store error: %s", res.Msg)
+		return
+	}
+}
+
+// BulkCreateItemStatus is one entry of the 207 Multi-Status response of a
+// best-effort batch.
+type BulkCreateItemStatus struct {
+	Index   int    `json:"index"`
+	Created bool   `json:"created"`
+	Error   string `json:"error,omitempty"`
+}
+
+// POST api/store/proxies:batch
+//
+// The default mode is transactional: either every entry is created or none.
+// ?mode=besteffort instead applies each valid entry, commits the successful
+// ones in a single reload and answers 207 with a per-item status array.
+func (svr *Service) apiBulkCreateStoreProxies(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+
+	log.Info("Http request [/api/store/proxies:batch]")
+	defer func() {
+		log.Info("Http response [/api/store/proxies:batch], code [%d]", res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+
+	body, err := readStoreRequestBody(r)
+	if err != nil {
+		res.Code = 400
+		res.Msg = err.Error()
+		return
+	}
+
+	var raws []json.RawMessage
+	if err := json.Unmarshal(body, &raws); err != nil {
+		res.Code = 400
+		res.Msg = fmt.Sprintf("request body should be a JSON array of proxy configs: %v", err)
+		return
+	}
+
+	mode := r.URL.Query().Get("mode")
+	if mode != "" && mode != "besteffort" {
+		res.Code = 400
+		res.Msg = "mode should be empty or besteffort"
+		return
+	}
+	if mode == "besteffort" {
+		results := svr.BulkCreateStoreProxiesBestEffort(raws)
+		statuses := make([]BulkCreateItemStatus, len(results))
+		for i, itemErr := range results {
+			statuses[i] = BulkCreateItemStatus{Index: i, Created: itemErr == nil}
+			if itemErr != nil {
+				statuses[i].Error = itemErr.Error()
+			}
+		}
+		res.Code = http.StatusMultiStatus
+		buf, _ := json.Marshal(statuses)
+		res.Msg = string(buf)
+		return
+	}
+
+	// validate every entry up front so a partially invalid batch doesn't
+	// mutate the store at all
+	itemErrors := make([]BulkCreateItemError, 0)
+	for i, raw := range raws {
+		if _, err := validateStoreProxyConf(raw); err != nil {
+			itemErrors = append(itemErrors, BulkCreateItemError{Index: i, Error: err.Error()})
+		}
+	}
+	if len(itemErrors) > 0 {
+		res.Code = 400
+		buf, _ := json.Marshal(&BulkCreateResp{Created: 0, Errors: itemErrors})
+		res.Msg = string(buf)
+		return
+	}
+
+	if err := svr.BulkCreateStoreProxies(raws); err != nil {
+		res.Code = storeErrorStatus(err)
+		res.Msg = storeErrorBody(err)
+		log.Warn("bulk create store proxies error: %s", res.Msg)
+		return
+	}
+
+	buf, _ := json.Marshal(&BulkCreateResp{Created: len(raws)})
+	res.Msg = string(buf)
+}
+
+type ListStoreProxiesResp struct {
+	Total   int                       `json:"total"`
+	Proxies []*config.StoreProxyEntry `json:"proxies"`
+}
+
+// storeEntryMatches applies the list filters against a raw store config. All
+// filters combine with AND semantics; an absent "enabled" field counts as
+// enabled.
+func storeEntryMatches(name string, raw json.RawMessage, pxyType, enabled, namePrefix string) bool {
+	if namePrefix != "" && !strings.HasPrefix(name, namePrefix) {
+		return false
+	}
+	if pxyType == "" && enabled == "" {
+		return true
+	}
+	var peek struct {
+		Type    string `json:"type"`
+		Enabled *bool  `json:"enabled"`
+	}
+	if err := json.Unmarshal(raw, &peek); err != nil {
+		return false
+	}
+	if peek.Type == "" {
+		peek.Type = consts.TCPProxy
+	}
+	if pxyType != "" && peek.Type != pxyType {
+		return false
+	}
+	if enabled != "" {
+		entryEnabled := peek.Enabled == nil || *peek.Enabled
+		if (enabled == "true") != entryEnabled {
+			return false
+		}
+	}
+	return true
+}
+
+// GET api/store/proxies
+func (svr *Service) apiListStoreProxies(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+
+	log.Info("Http request [/api/store/proxies]")
+	defer func() {
+		log.Info("Http response [/api/store/proxies], code [%d]", res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+
+	query := r.URL.Query()
+
+	// namesOnly short-circuits to a plain sorted name list, skipping the
+	// per-entry config payloads
+	if query.Get("namesOnly") == "true" {
+		names, err := svr.ListStoreProxyNames()
+		if err != nil {
+			res.Code = storeErrorStatus(err)
+			res.Msg = storeErrorBody(err)
+			return
+		}
+		buf, _ := json.Marshal(names)
+		res.Msg = string(buf)
+		return
+	}
+
+	entries, err := svr.ListStoreProxies()
+	if err != nil {
+		res.Code = storeErrorStatus(err)
+		res.Msg = storeErrorBody(err)
+		return
+	}
+	pxyType := query.Get("type")
+	enabled := query.Get("enabled")
+	namePrefix := query.Get("namePrefix")
+	if enabled != "" && enabled != "true" && enabled != "false" {
+		res.Code = 400
+		res.Msg = "enabled should be true or false"
+		return
+	}
+
+	sortBy := query.Get("sort")
+	if sortBy != "" && sortBy != "name" {
+		res.Code = 400
+		res.Msg = "sort should be empty or name"
+		return
+	}
+
+	filtered := make([]*config.StoreProxyEntry, 0, len(entries))
+	for _, entry := range entries {
+		if storeEntryMatches(entry.Name, entry.Conf, pxyType, enabled, namePrefix) {
+			e := *entry
+			e.Conf = canonicalJSON(e.Conf)
+			filtered = append(filtered, &e)
+		}
+	}
+	// entries come back in insertion order so lists stay stable across
+	// reloads; ?sort=name switches to alphabetical like the status endpoint
+	if sortBy == "name" {
+		sort.Slice(filtered, func(i, j int) bool { return filtered[i].Name < filtered[j].Name })
+	}
+	total := len(filtered)
+
+	offset, limit := 0, -1
+	if v := query.Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			res.Code = 400
+			res.Msg = "offset should be a non-negative integer"
+			return
+		}
+	}
+	if v := query.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 0 {
+			res.Code = 400
+			res.Msg = "limit should be a non-negative integer"
+			return
+		}
+	}
+	if offset > len(filtered) {
+		offset = len(filtered)
+	}
+	filtered = filtered[offset:]
+	if limit >= 0 && limit < len(filtered) {
+		filtered = filtered[:limit]
+	}
+
+	buf, _ := json.Marshal(&ListStoreProxiesResp{Total: total, Proxies: filtered})
+	res.Msg = string(buf)
+}
+
+// GET api/store/proxies/{name}
+//
+// The response carries the submitted config with its keys in sorted order,
+// so two GETs of equal configs are byte-identical and diff cleanly: runtime
+// defaults (local_ip and friends) are injected when proxies are built from
+// the store, never persisted into it. ?raw=true names this, the only served
+// representation, explicitly. The completed runtime view lives at
+// /api/config/runtime.
+func (svr *Service) apiGetStoreProxy(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+	name := mux.Vars(r)["name"]
+
+	log.Info("Http request [/api/store/proxies/%s]", name)
+	defer func() {
+		log.Info("Http response [/api/store/proxies/%s], code [%d]", name, res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+
+	if raw := r.URL.Query().Get("raw"); raw != "" && raw != "true" {
+		res.Code = 400
+		res.Msg = "raw should be empty or true"
+		return
+	}
+
+	entry, err := svr.GetStoreProxy(name)
+	if err != nil {
+		res.Code = storeErrorStatus(err)
+		res.Msg = storeErrorBody(err)
+		return
+	}
+	w.Header().Set("ETag", fmt.Sprintf("\"%d\"", entry.Revision))
+	res.Msg = string(canonicalJSON(entry.Conf))
+}
+
+// PUT api/store/proxies/{name}
+func (svr *Service) apiUpdateStoreProxy(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+	name := mux.Vars(r)["name"]
+
+	log.Info("Http request [/api/store/proxies/%s]", name)
+	defer func() {
+		log.Info("Http response [/api/store/proxies/%s], code [%d]", name, res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+
+	body, err := readStoreRequestBody(r)
+	if err != nil {
+		res.Code = 400
+		res.Msg = err.Error()
+		return
+	}
+
+	// an If-Match header carrying the revision from a previous GET makes the
+	// update conditional
+	expectedRevision, err := parseIfMatchRevision(r)
+	if err != nil {
+		res.Code = 400
+		res.Msg = err.Error()
+		return
+	}
+
+	if err := svr.UpdateStoreProxy(name, body, expectedRevision); err != nil {
+		res.Code = storeErrorStatus(err)
+		res.Msg = storeErrorBody(err)
+		log.Warn("update store proxy error: %s", res.Msg)
+		return
+	}
+}
+
+// PATCH api/store/proxies/{name}
+func (svr *Service) apiPatchStoreProxy(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+	name := mux.Vars(r)["name"]
+
+	log.Info("Http request [/api/store/proxies/%s]", name)
+	defer func() {
+		log.Info("Http response [/api/store/proxies/%s], code [%d]", name, res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+
+	body, err := readStoreRequestBody(r)
+	if err != nil {
+		res.Code = 400
+		res.Msg = err.Error()
+		return
+	}
+
+	if err := svr.PatchStoreProxy(name, body); err != nil {
+		res.Code = storeErrorStatus(err)
+		res.Msg = storeErrorBody(err)
+		log.Warn("patch store proxy error: %s", res.Msg)
+		return
+	}
+}
+
+// POST api/store/proxies/{name}/rename
+func (svr *Service) apiRenameStoreProxy(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+	name := mux.Vars(r)["name"]
+
+	log.Info("Http request [/api/store/proxies/%s/rename]", name)
+	defer func() {
+		log.Info("Http response [/api/store/proxies/%s/rename], code [%d]", name, res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+
+	body, err := readStoreRequestBody(r)
+	if err != nil {
+		res.Code = 400
+		res.Msg = err.Error()
+		return
+	}
+
+	var req struct {
+		NewName string `json:"newName"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		res.Code = 400
+		res.Msg = err.Error()
+		return
+	}
+
+	if err := svr.RenameStoreProxy(name, req.NewName); err != nil {
+		res.Code = storeErrorStatus(err)
+		res.Msg = storeErrorBody(err)
+		log.Warn("rename store proxy error: %s", res.Msg)
+		return
+	}
+}
+
+// apiSetStoreProxyEnabled powers the enable/disable endpoints.
+func (svr *Service) apiSetStoreProxyEnabled(w http.ResponseWriter, r *http.Request, enabled bool) {
+	res := GeneralResponse{Code: 200}
+	name := mux.Vars(r)["name"]
+	action := "enable"
+	if !enabled {
+		action = "disable"
+	}
+
+	log.Info("Http request [/api/store/proxies/%s/%s]", name, action)
+	defer func() {
+		log.Info("Http response [/api/store/proxies/%s/%s], code [%d]", name, action, res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+
+	if err := svr.SetStoreProxyEnabled(name, enabled); err != nil {
+		res.Code = storeErrorStatus(err)
+		res.Msg = storeErrorBody(err)
+		log.Warn("%s store proxy error: %s", action, res.Msg)
+		return
+	}
+}
+
+// POST api/store/proxies/{name}/enable
+func (svr *Service) apiEnableStoreProxy(w http.ResponseWriter, r *http.Request) {
+	svr.apiSetStoreProxyEnabled(w, r, true)
+}
+
+// POST api/store/proxies/{name}/disable
+func (svr *Service) apiDisableStoreProxy(w http.ResponseWriter, r *http.Request) {
+	svr.apiSetStoreProxyEnabled(w, r, false)
+}
+
+// SetHealthCheckReq is the payload of the health-check override endpoint.
+type SetHealthCheckReq struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// POST api/store/proxies/{name}/healthcheck
+func (svr *Service) apiSetStoreProxyHealthCheck(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+	name := mux.Vars(r)["name"]
+
+	log.Info("Http request [/api/store/proxies/%s/healthcheck]", name)
+	defer func() {
+		log.Info("Http response [/api/store/proxies/%s/healthcheck], code [%d]", name, res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+
+	body, err := readStoreRequestBody(r)
+	if err != nil {
+		res.Code = 400
+		res.Msg = err.Error()
+		return
+	}
+
+	var req SetHealthCheckReq
+	if err := json.Unmarshal(body, &req); err != nil || req.Enabled == nil {
+		res.Code = 400
+		res.Msg = `request body should be a JSON object with an "enabled" boolean`
+		return
+	}
+
+	if err := svr.SetStoreProxyHealthCheckEnabled(name, *req.Enabled); err != nil {
+		res.Code = storeErrorStatus(err)
+		res.Msg = storeErrorBody(err)
+		log.Warn("set store proxy health check error: %s", res.Msg)
+		return
+	}
+}
+
+// TestBackendResp reports the outcome of a single backend connectivity
+// probe.
+type TestBackendResp struct {
+	Reachable bool   `json:"reachable"`
+	LatencyMs int64  `json:"latencyMs,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// POST api/store/proxies/{name}/clone
+func (svr *Service) apiCloneStoreProxy(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+	name := mux.Vars(r)["name"]
+
+	log.Info("Http request [/api/store/proxies/%s/clone]", name)
+	defer func() {
+		log.Info("Http response [/api/store/proxies/%s/clone], code [%d]", name, res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+
+	body, err := readStoreRequestBody(r)
+	if err != nil {
+		res.Code = 400
+		res.Msg = err.Error()
+		return
+	}
+
+	var req struct {
+		NewName string `json:"newName"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		res.Code = 400
+		res.Msg = err.Error()
+		return
+	}
+
+	if err := svr.CloneStoreProxy(name, req.NewName); err != nil {
+		res.Code = storeErrorStatus(err)
+		res.Msg = storeErrorBody(err)
+		log.Warn("clone store proxy error: %s", res.Msg)
+		return
+	}
+}
+
+// POST api/store/proxies/{name}/bandwidth
+func (svr *Service) apiSetStoreProxyBandwidth(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+	name := mux.Vars(r)["name"]
+
+	log.Info("Http request [/api/store/proxies/%s/bandwidth]", name)
+	defer func() {
+		log.Info("Http response [/api/store/proxies/%s/bandwidth], code [%d]", name, res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+
+	body, err := readStoreRequestBody(r)
+	if err != nil {
+		res.Code = 400
+		res.Msg = err.Error()
+		return
+	}
+
+	var req struct {
+		BandwidthLimit string `json:"bandwidth_limit"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		res.Code = 400
+		res.Msg = err.Error()
+		return
+	}
+
+	if err := svr.UpdateStoreProxyBandwidth(name, req.BandwidthLimit); err != nil {
+		res.Code = storeErrorStatus(err)
+		res.Msg = storeErrorBody(err)
+		log.Warn("set store proxy bandwidth error: %s", res.Msg)
+		return
+	}
+}
+
+// POST api/store/proxies/{name}/test
+func (svr *Service) apiTestStoreProxyBackend(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+	name := mux.Vars(r)["name"]
+
+	log.Info("Http request [/api/store/proxies/%s/test]", name)
+	defer func() {
+		log.Info("Http response [/api/store/proxies/%s/test], code [%d]", name, res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+
+	reachable, latency, err := svr.TestStoreProxyBackend(name)
+	if err != nil && !errors.Is(err, ErrBackendUnreachable) {
+		res.Code = storeErrorStatus(err)
+		res.Msg = storeErrorBody(err)
+		return
+	}
+
+	resp := &TestBackendResp{Reachable: reachable}
+	if reachable {
+		resp.LatencyMs = latency.Milliseconds()
+	} else {
+		resp.Error = err.Error()
+	}
+	buf, _ := json.Marshal(resp)
+	res.Msg = string(buf)
+}
+
+// DELETE api/store/proxies/{name}
+func (svr *Service) apiDeleteStoreProxy(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+	name := mux.Vars(r)["name"]
+
+	log.Info("Http request [/api/store/proxies/%s]", name)
+	defer func() {
+		log.Info("Http response [/api/store/proxies/%s], code [%d]", name, res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+
+	force := r.URL.Query().Get("force") == "true"
+	if err := svr.DeleteStoreProxy(name, force); err != nil {
+		res.Code = storeErrorStatus(err)
+		res.Msg = storeErrorBody(err)
+		log.Warn("delete store proxy error: %s", res.Msg)
+		return
+	}
+}
+
+// GET api/store/export
+func (svr *Service) apiExportStore(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+
+	log.Info("Http request [/api/store/export]")
+	defer func() {
+		log.Info("Http response [/api/store/export], code [%d]", res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+
+	format := r.URL.Query().Get("format")
+	content, err := svr.ExportStore(format)
+	if err != nil {
+		res.Code = storeErrorStatus(err)
+		res.Msg = storeErrorBody(err)
+		return
+	}
+	res.Msg = string(content)
+}
+
+type ValidateResp struct {
+	Valid bool `json:"valid"`
+}
+
+// apiValidateConf powers the validate-only endpoints: it runs validate over
+// the request body and reports the result without touching the store or the
+// running config.
+func (svr *Service) apiValidateConf(w http.ResponseWriter, r *http.Request, kind string, validate func(json.RawMessage) (string, error)) {
+	res := GeneralResponse{Code: 200}
+
+	log.Info("Http request [/api/validate/%s]", kind)
+	defer func() {
+		log.Info("Http response [/api/validate/%s], code [%d]", kind, res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+
+	body, err := readStoreRequestBody(r)
+	if err != nil {
+		res.Code = 400
+		res.Msg = err.Error()
+		return
+	}
+
+	if _, err := validate(body); err != nil {
+		res.Code = 400
+		res.Msg = err.Error()
+		return
+	}
+
+	buf, _ := json.Marshal(&ValidateResp{Valid: true})
+	res.Msg = string(buf)
+}
+
+// POST api/validate/proxy
+func (svr *Service) apiValidateProxy(w http.ResponseWriter, r *http.Request) {
+	svr.apiValidateConf(w, r, "proxy", validateStoreProxyConf)
+}
+
+// POST api/validate/visitor
+func (svr *Service) apiValidateVisitor(w http.ResponseWriter, r *http.Request) {
+	svr.apiValidateConf(w, r, "visitor", svr.validateStoreVisitorConf)
+}
+
+// GET api/store/groups
+func (svr *Service) apiListStoreGroups(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+
+	log.Info("Http request [/api/store/groups]")
+	defer func() {
+		log.Info("Http response [/api/store/groups], code [%d]", res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+
+	groups, err := svr.ListStoreProxyGroups()
+	if err != nil {
+		res.Code = storeErrorStatus(err)
+		res.Msg = storeErrorBody(err)
+		return
+	}
+
+	buf, _ := json.Marshal(groups)
+	res.Msg = string(buf)
+}
+
+// apiSetStoreGroupEnabled powers the group enable/disable endpoints.
+func (svr *Service) apiSetStoreGroupEnabled(w http.ResponseWriter, r *http.Request, enabled bool) {
+	res := GeneralResponse{Code: 200}
+	group := mux.Vars(r)["group"]
+	action := "enable"
+	if !enabled {
+		action = "disable"
+	}
+
+	log.Info("Http request [/api/store/groups/%s/%s]", group, action)
+	defer func() {
+		log.Info("Http response [/api/store/groups/%s/%s], code [%d]", group, action, res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+
+	if err := svr.SetStoreProxyGroupEnabled(group, enabled); err != nil {
+		res.Code = storeErrorStatus(err)
+		res.Msg = storeErrorBody(err)
+		log.Warn("%s store group error: %s", action, res.Msg)
+		return
+	}
+}
+
+// POST api/store/groups/{group}/enable
+func (svr *Service) apiEnableStoreGroup(w http.ResponseWriter, r *http.Request) {
+	svr.apiSetStoreGroupEnabled(w, r, true)
+}
+
+// POST api/store/groups/{group}/disable
+func (svr *Service) apiDisableStoreGroup(w http.ResponseWriter, r *http.Request) {
+	svr.apiSetStoreGroupEnabled(w, r, false)
+}
+
+// GET api/store/diff
+func (svr *Service) apiStoreDiff(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+
+	log.Info("Http request [/api/store/diff]")
+	defer func() {
+		log.Info("Http response [/api/store/diff], code [%d]", res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+
+	diff, err := svr.DiffStore()
+	if err != nil {
+		res.Code = storeErrorStatus(err)
+		res.Msg = storeErrorBody(err)
+		return
+	}
+
+	buf, _ := json.Marshal(diff)
+	res.Msg = string(buf)
+}
+
+// POST api/store/visitors
+func (svr *Service) apiCreateStoreVisitor(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+
+	log.Info("Http request [/api/store/visitors]")
+	defer func() {
+		log.Info("Http response [/api/store/visitors], code [%d]", res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+
+	body, err := readStoreRequestBody(r)
+	if err != nil {
+		res.Code = 400
+		res.Msg = err.Error()
+		return
+	}
+
+	if err := svr.CreateStoreVisitor(body); err != nil {
+		res.Code = storeErrorStatus(err)
+		res.Msg = storeErrorBody(err)
+		log.Warn("create store visitor error: %s", res.Msg)
+		return
+	}
+}
+
+// GET api/store/visitors
+func (svr *Service) apiListStoreVisitors(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+
+	log.Info("Http request [/api/store/visitors]")
+	defer func() {
+		log.Info("Http response [/api/store/visitors], code [%d]", res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+
+	query := r.URL.Query()
+	serverName := query.Get("serverName")
+	enabled := query.Get("enabled")
+	if enabled != "" && enabled != "true" && enabled != "false" {
+		res.Code = 400
+		res.Msg = "enabled should be true or false"
+		return
+	}
+
+	entries, err := svr.ListStoreVisitors()
+	if err != nil {
+		res.Code = storeErrorStatus(err)
+		res.Msg = storeErrorBody(err)
+		return
+	}
+
+	filtered := make([]*config.StoreVisitorEntry, 0, len(entries))
+	for _, entry := range entries {
+		if storeVisitorEntryMatches(entry.Conf, serverName, enabled) {
+			e := *entry
+			e.Conf = canonicalJSON(e.Conf)
+			filtered = append(filtered, &e)
+		}
+	}
+
+	buf, _ := json.Marshal(filtered)
+	res.Msg = string(buf)
+}
+
+// storeVisitorEntryMatches applies the visitor list filters against a raw
+// store config, with the same AND semantics as storeEntryMatches.
+func storeVisitorEntryMatches(raw json.RawMessage, serverName, enabled string) bool {
+	if serverName == "" && enabled == "" {
+		return true
+	}
+	var peek struct {
+		ServerName string `json:"server_name"`
+		Enabled    *bool  `json:"enabled"`
+	}
+	if err := json.Unmarshal(raw, &peek); err != nil {
+		return false
+	}
+	if serverName != "" && peek.ServerName != serverName {
+		return false
+	}
+	if enabled != "" {
+		entryEnabled := peek.Enabled == nil || *peek.Enabled
+		if (enabled == "true") != entryEnabled {
+			return false
+		}
+	}
+	return true
+}
+
+// GET api/store/visitors/{name}
+func (svr *Service) apiGetStoreVisitor(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+	name := mux.Vars(r)["name"]
+
+	log.Info("Http request [/api/store/visitors/%s]", name)
+	defer func() {
+		log.Info("Http response [/api/store/visitors/%s], code [%d]", name, res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+
+	conf, err := svr.GetStoreVisitor(name)
+	if err != nil {
+		res.Code = storeErrorStatus(err)
+		res.Msg = storeErrorBody(err)
+		return
+	}
+	res.Msg = string(canonicalJSON(conf))
+}
+
+// PUT api/store/visitors/{name}
+func (svr *Service) apiUpdateStoreVisitor(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+	name := mux.Vars(r)["name"]
+
+	log.Info("Http request [/api/store/visitors/%s]", name)
+	defer func() {
+		log.Info("Http response [/api/store/visitors/%s], code [%d]", name, res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+
+	body, err := readStoreRequestBody(r)
+	if err != nil {
+		res.Code = 400
+		res.Msg = err.Error()
+		return
+	}
+
+	if err := svr.UpdateStoreVisitor(name, body); err != nil {
+		res.Code = storeErrorStatus(err)
+		res.Msg = storeErrorBody(err)
+		log.Warn("update store visitor error: %s", res.Msg)
+		return
+	}
+}
+
+// DELETE api/store/visitors/{name}
+func (svr *Service) apiDeleteStoreVisitor(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+	name := mux.Vars(r)["name"]
+
+	log.Info("Http request [/api/store/visitors/%s]", name)
+	defer func() {
+		log.Info("Http response [/api/store/visitors/%s], code [%d]", name, res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+
+	if err := svr.DeleteStoreVisitor(name); err != nil {
+		res.Code = storeErrorStatus(err)
+		res.Msg = storeErrorBody(err)
+		log.Warn("delete store visitor error: %s", res.Msg)
+		return
+	}
+}
@@ -26,6 +26,7 @@ import (
 
 	"github.com/fatedier/frp/pkg/config"
 	"github.com/fatedier/frp/pkg/msg"
+	visitorPlugin "github.com/fatedier/frp/pkg/plugin/visitor"
 	"github.com/fatedier/frp/pkg/proto/udp"
 	frpNet "github.com/fatedier/frp/pkg/util/net"
 	"github.com/fatedier/frp/pkg/util/util"
@@ -73,12 +74,28 @@ func NewVisitor(ctx context.Context, ctl *Control, cfg config.VisitorConf) (visi
 type BaseVisitor struct {
 	ctl    *Control
 	l      net.Listener
+	plugin visitorPlugin.Plugin
 	closed bool
 
 	mu  sync.RWMutex
 	ctx context.Context
 }
 
+// initPlugin creates the visitor-side plugin when one is configured. It runs
+// from Run so a bad plugin configuration fails the visitor up front instead
+// of on the first connection.
+func (bv *BaseVisitor) initPlugin(cfg *config.BaseVisitorConf) error {
+	if cfg.Plugin == "" {
+		return nil
+	}
+	p, err := visitorPlugin.Create(cfg.Plugin, cfg.PluginParams)
+	if err != nil {
+		return fmt.Errorf("create visitor plugin error: %v", err)
+	}
+	bv.plugin = p
+	return nil
+}
+
 type STCPVisitor struct {
 	*BaseVisitor
 
@@ -86,6 +103,10 @@ type STCPVisitor struct {
 }
 
 func (sv *STCPVisitor) Run() (err error) {
+	if err = sv.initPlugin(sv.cfg.GetBaseInfo()); err != nil {
+		return
+	}
+
 	sv.l, err = net.Listen("tcp", fmt.Sprintf("%s:%d", sv.cfg.BindAddr, sv.cfg.BindPort))
 	if err != nil {
 		return
@@ -97,6 +118,30 @@ func (sv *STCPVisitor) Run() (err error) {
 
 func (sv *STCPVisitor) Close() {
 	sv.l.Close()
+	if sv.plugin != nil {
+		sv.plugin.Close()
+	}
+}
+
+// visitorDialTimeout returns the deadline for the handshake with the server
+// when a user connection comes in; dial_timeout_s overrides the 10s default.
+func visitorDialTimeout(cfg *config.BaseVisitorConf) time.Duration {
+	if cfg.DialTimeoutS > 0 {
+		return time.Duration(cfg.DialTimeoutS) * time.Second
+	}
+	return 10 * time.Second
+}
+
+// applyVisitorKeepAlive enables TCP keepalive on an accepted user connection
+// when keep_alive_s is configured.
+func applyVisitorKeepAlive(conn net.Conn, cfg *config.BaseVisitorConf) {
+	if cfg.KeepAliveS <= 0 {
+		return
+	}
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.SetKeepAlive(true)
+		tcpConn.SetKeepAlivePeriod(time.Duration(cfg.KeepAliveS) * time.Second)
+	}
 }
 
 func (sv *STCPVisitor) worker() {
@@ -107,6 +152,7 @@ func (sv *STCPVisitor) worker() {
 			xl.Warn("stcp local listener closed")
 			return
 		}
+		applyVisitorKeepAlive(conn, sv.cfg.GetBaseInfo())
 
 		go sv.handleConn(conn)
 	}
@@ -138,7 +184,7 @@ func (sv *STCPVisitor) handleConn(userConn net.Conn) {
 	}
 
 	var newVisitorConnRespMsg msg.NewVisitorConnResp
-	visitorConn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	visitorConn.SetReadDeadline(time.Now().Add(visitorDialTimeout(sv.cfg.GetBaseInfo())))
 	err = msg.ReadMsgInto(visitorConn, &newVisitorConnRespMsg)
 	if err != nil {
 		xl.Warn("get newVisitorConnRespMsg error: %v", err)
@@ -165,6 +211,10 @@ func (sv *STCPVisitor) handleConn(userConn net.Conn) {
 		remote = frpIo.WithCompression(remote)
 	}
 
+	if sv.plugin != nil {
+		sv.plugin.Handle(userConn, remote)
+		return
+	}
 	frpIo.Join(userConn, remote)
 }
 
@@ -175,6 +225,10 @@ type XTCPVisitor struct {
 }
 
 func (sv *XTCPVisitor) Run() (err error) {
+	if err = sv.initPlugin(sv.cfg.GetBaseInfo()); err != nil {
+		return
+	}
+
 	sv.l, err = net.Listen("tcp", fmt.Sprintf("%s:%d", sv.cfg.BindAddr, sv.cfg.BindPort))
 	if err != nil {
 		return
@@ -186,6 +240,9 @@ func (sv *XTCPVisitor) Run() (err error) {
 
 func (sv *XTCPVisitor) Close() {
 	sv.l.Close()
+	if sv.plugin != nil {
+		sv.plugin.Close()
+	}
 }
 
 func (sv *XTCPVisitor) worker() {
@@ -196,6 +253,7 @@ func (sv *XTCPVisitor) worker() {
 			xl.Warn("xtcp local listener closed")
 			return
 		}
+		applyVisitorKeepAlive(conn, sv.cfg.GetBaseInfo())
 
 		go sv.handleConn(conn)
 	}
@@ -239,7 +297,7 @@ func (sv *XTCPVisitor) handleConn(userConn net.Conn) {
 
 	// Wait for client address at most 10 seconds.
 	var natHoleRespMsg msg.NatHoleResp
-	visitorConn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	visitorConn.SetReadDeadline(time.Now().Add(visitorDialTimeout(sv.cfg.GetBaseInfo())))
 	buf := pool.GetBuf(1024)
 	n, err := visitorConn.Read(buf)
 	if err != nil {
@@ -333,6 +391,10 @@ func (sv *XTCPVisitor) handleConn(userConn net.Conn) {
 		muxConnRWCloser = frpIo.WithCompression(muxConnRWCloser)
 	}
 
+	if sv.plugin != nil {
+		sv.plugin.Handle(userConn, muxConnRWCloser)
+		return
+	}
 	frpIo.Join(userConn, muxConnRWCloser)
 	xl.Debug("join connections closed")
 }
@@ -377,6 +439,12 @@ func (sv *SUDPVisitor) Run() (err error) {
 func (sv *SUDPVisitor) dispatcher() {
 	xl := xlog.FromContextSafe(sv.ctx)
 
+	reconnectInterval := 3 * time.Second
+	if sv.cfg.ReconnectIntervalS > 0 {
+		reconnectInterval = time.Duration(sv.cfg.ReconnectIntervalS) * time.Second
+	}
+	failedRetries := 0
+
 	for {
 		// loop for get frpc to frps tcp conn
 		// setup worker
@@ -393,11 +461,18 @@ func (sv *SUDPVisitor) dispatcher() {
 			default:
 			}
 
-			time.Sleep(3 * time.Second)
+			failedRetries++
+			if sv.cfg.ReconnectMaxRetries > 0 && failedRetries >= sv.cfg.ReconnectMaxRetries {
+				xl.Warn("newVisitorConn to frps error: %v, gave up after %d retries", err, failedRetries)
+				return
+			}
+
+			time.Sleep(reconnectInterval)
 
 			xl.Warn("newVisitorConn to frps error: %v, try to reconnect", err)
 			continue
 		}
+		failedRetries = 0
 
 		sv.worker(visitorConn)
 
@@ -510,7 +585,7 @@ func (sv *SUDPVisitor) getNewVisitorConn() (net.Conn, error) {
 	}
 
 	var newVisitorConnRespMsg msg.NewVisitorConnResp
-	visitorConn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	visitorConn.SetReadDeadline(time.Now().Add(visitorDialTimeout(sv.cfg.GetBaseInfo())))
 	err = msg.ReadMsgInto(visitorConn, &newVisitorConnRespMsg)
 	if err != nil {
 		return nil, fmt.Errorf("frpc read newVisitorConnRespMsg error: %v", err)
@@ -28,6 +28,9 @@ type VisitorManager struct {
 
 	cfgs     map[string]config.VisitorConf
 	visitors map[string]Visitor
+	// startErrs keeps the last start error per visitor name until the
+	// visitor starts successfully or is removed
+	startErrs map[string]string
 
 	checkInterval time.Duration
 
@@ -42,6 +45,7 @@ func NewVisitorManager(ctx context.Context, ctl *Control) *VisitorManager {
 		ctl:           ctl,
 		cfgs:          make(map[string]config.VisitorConf),
 		visitors:      make(map[string]Visitor),
+		startErrs:     make(map[string]string),
 		checkInterval: 10 * time.Second,
 		ctx:           ctx,
 		stopCh:        make(chan struct{}),
@@ -81,13 +85,59 @@ func (vm *VisitorManager) startVisitor(cfg config.VisitorConf) (err error) {
 	err = visitor.Run()
 	if err != nil {
 		xl.Warn("start error: %v", err)
+		vm.startErrs[name] = err.Error()
 	} else {
 		vm.visitors[name] = visitor
+		delete(vm.startErrs, name)
 		xl.Info("start visitor success")
 	}
 	return
 }
 
+// VisitorStatus describes one visitor's working state for the admin API.
+type VisitorStatus struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Status string `json:"status"`
+	Err    string `json:"err"`
+}
+
+const (
+	// VisitorStatusListening means the visitor's bind listener is accepting
+	// connections.
+	VisitorStatusListening = "listening"
+	// VisitorStatusStartErr means the last start attempt failed; the manager
+	// retries periodically.
+	VisitorStatusStartErr = "start error"
+	// VisitorStatusWaitStart means the visitor hasn't been started yet.
+	VisitorStatusWaitStart = "wait start"
+)
+
+// GetAllVisitorStatus reports the working state of every configured visitor,
+// mirroring what the proxy manager exposes for proxies.
+func (vm *VisitorManager) GetAllVisitorStatus() []VisitorStatus {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+
+	statuses := make([]VisitorStatus, 0, len(vm.cfgs))
+	for name, cfg := range vm.cfgs {
+		vs := VisitorStatus{
+			Name: name,
+			Type: cfg.GetBaseInfo().ProxyType,
+		}
+		if _, ok := vm.visitors[name]; ok {
+			vs.Status = VisitorStatusListening
+		} else if errMsg, ok := vm.startErrs[name]; ok {
+			vs.Status = VisitorStatusStartErr
+			vs.Err = errMsg
+		} else {
+			vs.Status = VisitorStatusWaitStart
+		}
+		statuses = append(statuses, vs)
+	}
+	return statuses
+}
+
 func (vm *VisitorManager) Reload(cfgs map[string]config.VisitorConf) {
 	xl := xlog.FromContextSafe(vm.ctx)
 	vm.mu.Lock()
@@ -112,6 +162,7 @@ func (vm *VisitorManager) Reload(cfgs map[string]config.VisitorConf) {
 				visitor.Close()
 			}
 			delete(vm.visitors, name)
+			delete(vm.startErrs, name)
 		}
 	}
 	if len(delNames) > 0 {
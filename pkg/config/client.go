@@ -16,6 +16,7 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"strings"
@@ -38,6 +39,15 @@ type ClientCommonConf struct {
 	// ServerPort specifies the port to connect to the server on. By default,
 	// this value is 7000.
 	ServerPort int `ini:"server_port" json:"server_port"`
+	// ServerAddrs specifies a prioritized list of server addresses in
+	// "host:port" format. If this value is not empty, the client will connect
+	// to the first address and fail over to the next one when the current
+	// server is unreachable, cycling through the list. Every reconnect round
+	// starts from the first address again, and while connected to a backup
+	// the first address is probed periodically so the client switches back
+	// once it recovers. ServerAddr and ServerPort are ignored when this
+	// value is set. By default, this value is an empty list.
+	ServerAddrs []string `ini:"server_addrs" json:"server_addrs"`
 	// HTTPProxy specifies a proxy address to connect to the server through. If
 	// this value is "", the server will be connected to directly. By default,
 	// this value is read from the "http_proxy" environment variable.
@@ -74,10 +84,44 @@ type ClientCommonConf struct {
 	// AdminPwd specifies the password that the admin server will use for
 	// login.
 	AdminPwd string `ini:"admin_pwd" json:"admin_pwd"`
+	// AdminReadOnly rejects every mutating admin API request with 403,
+	// leaving list, get and status endpoints working. Useful when the API is
+	// exposed for monitoring only. By default, this value is false.
+	AdminReadOnly bool `ini:"admin_read_only" json:"admin_read_only"`
+	// AdminCorsOrigins lists origins allowed to call the admin API from a
+	// browser. Cross-origin requests from other origins are refused, and with
+	// an empty list CORS handling is disabled entirely. By default, this
+	// value is an empty set.
+	AdminCorsOrigins []string `ini:"admin_cors_origins" json:"admin_cors_origins"`
 	// AssetsDir specifies the local directory that the admin server will load
 	// resources from. If this value is "", assets will be loaded from the
 	// bundled executable using statik. By default, this value is "".
 	AssetsDir string `ini:"assets_dir" json:"assets_dir"`
+	// PprofEnable enables golang pprof handlers in the admin server. The
+	// admin server must be started first. By default, this value is false.
+	PprofEnable bool `ini:"pprof_enable" json:"pprof_enable"`
+	// StoreFile specifies a file used to persist proxies and visitors
+	// managed through the admin API. If this value is "", the store
+	// endpoints of the admin API are disabled. By default, this value is "".
+	StoreFile string `ini:"store_file" json:"store_file"`
+	// StoreMinSecretKeyLength rejects store visitors whose secret key is
+	// shorter than this many characters. By default, this value is 0, which
+	// disables the check.
+	StoreMinSecretKeyLength int64 `ini:"store_min_secret_key_length" json:"store_min_secret_key_length"`
+	// StoreRenderEnvs renders "{{ .Envs.FOO }}" style placeholders in store
+	// configs at reload time. Entries are persisted with the placeholders
+	// intact. By default, this value is false.
+	StoreRenderEnvs bool `ini:"store_render_envs" json:"store_render_envs"`
+	// StoreWebhookURL receives a POSTed JSON event after every successful
+	// store mutation, carrying the entity type, name and operation. Delivery
+	// failures are logged and never fail the mutation. If this value is "",
+	// no events are sent. By default, this value is "".
+	StoreWebhookURL string `ini:"store_webhook_url" json:"store_webhook_url"`
+	// StoreRemoteURL bootstraps the store from a remote JSON or YAML
+	// definition on startup, persisting it to StoreFile. Later mutations stay
+	// local. If the fetch fails, an existing local store file is used
+	// instead. By default, this value is "".
+	StoreRemoteURL string `ini:"store_remote_url" json:"store_remote_url"`
 	// PoolCount specifies the number of connections the client will make to
 	// the server in advance. By default, this value is 0.
 	PoolCount int `ini:"pool_count" json:"pool_count"`
@@ -147,6 +191,7 @@ func GetDefaultClientConf() ClientCommonConf {
 		ClientConfig:       auth.GetDefaultClientConf(),
 		ServerAddr:         "0.0.0.0",
 		ServerPort:         7000,
+		ServerAddrs:        make([]string, 0),
 		HTTPProxy:          os.Getenv("http_proxy"),
 		LogFile:            "console",
 		LogWay:             "console",
@@ -157,6 +202,7 @@ func GetDefaultClientConf() ClientCommonConf {
 		AdminPort:          0,
 		AdminUser:          "",
 		AdminPwd:           "",
+		AdminCorsOrigins:   make([]string, 0),
 		AssetsDir:          "",
 		PoolCount:          1,
 		TCPMux:             true,
@@ -212,6 +258,20 @@ func (cfg *ClientCommonConf) Validate() error {
 		return fmt.Errorf("invalid protocol")
 	}
 
+	for _, addr := range cfg.ServerAddrs {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("invalid server_addrs entry [%s]: %v", addr, err)
+		}
+	}
+
+	if cfg.StoreMinSecretKeyLength < 0 {
+		return fmt.Errorf("invalid store_min_secret_key_length")
+	}
+
+	if err := ValidateUserName(cfg.User); err != nil {
+		return err
+	}
+
 	for _, f := range cfg.IncludeConfigFiles {
 		absDir, err := filepath.Abs(filepath.Dir(f))
 		if err != nil {
@@ -275,7 +335,10 @@ func LoadAllProxyConfsFromIni(
 	visitorConfs := make(map[string]VisitorConf)
 
 	if prefix != "" {
-		prefix += "."
+		if err := ValidateUserName(prefix); err != nil {
+			return nil, nil, err
+		}
+		prefix += proxyNameSeparator
 	}
 
 	startProxy := make(map[string]struct{})
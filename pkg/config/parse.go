@@ -65,6 +65,37 @@ func ParseClientConfig(filePath string) (
 	return
 }
 
+// ValidateClientConfigContent runs the same load and validate pipeline as
+// ParseClientConfig against in-memory content, without writing anything to
+// disk. It is used to check a new configuration before persisting it.
+func ValidateClientConfigContent(content []byte) error {
+	rendered, err := RenderContent(content)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := UnmarshalClientConfFromIni(rendered)
+	if err != nil {
+		return err
+	}
+	cfg.Complete()
+	if err = cfg.Validate(); err != nil {
+		return fmt.Errorf("Parse config error: %v", err)
+	}
+
+	configBuffer := bytes.NewBuffer(nil)
+	configBuffer.Write(rendered)
+	buf, err := getIncludeContents(cfg.IncludeConfigFiles)
+	if err != nil {
+		return fmt.Errorf("getIncludeContents error: %v", err)
+	}
+	configBuffer.WriteString("\n")
+	configBuffer.Write(buf)
+
+	_, _, err = LoadAllProxyConfsFromIni(cfg.User, configBuffer.Bytes(), cfg.Start)
+	return err
+}
+
 // getIncludeContents renders all configs from paths.
 // files format can be a single file path or directory or regex path.
 func getIncludeContents(paths []string) ([]byte, error) {
@@ -16,6 +16,7 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"reflect"
 	"strings"
 
@@ -140,6 +141,15 @@ type BaseProxyConf struct {
 	// 0 means no limit
 	BandwidthLimit BandwidthQuantity `ini:"bandwidth_limit" json:"bandwidth_limit"`
 
+	// AcceptRateLimit limits how fast new work connections are handed to the
+	// local service, in connections per second. Connections beyond the limit
+	// are rejected. By default, this value is 0, meaning no limit.
+	AcceptRateLimit float64 `ini:"accept_rate_limit" json:"accept_rate_limit"`
+	// AcceptRateBurst specifies how many connections may exceed
+	// AcceptRateLimit in a burst. It is only used when AcceptRateLimit is
+	// set. By default, this value is 1.
+	AcceptRateBurst int `ini:"accept_rate_burst" json:"accept_rate_burst"`
+
 	// meta info for each proxy
 	Metas map[string]string `ini:"-" json:"metas"`
 
@@ -331,6 +341,8 @@ func (cfg *BaseProxyConf) compare(cmp *BaseProxyConf) bool {
 		cfg.GroupKey != cmp.GroupKey ||
 		cfg.ProxyProtocolVersion != cmp.ProxyProtocolVersion ||
 		!cfg.BandwidthLimit.Equal(&cmp.BandwidthLimit) ||
+		cfg.AcceptRateLimit != cmp.AcceptRateLimit ||
+		cfg.AcceptRateBurst != cmp.AcceptRateBurst ||
 		!reflect.DeepEqual(cfg.Metas, cmp.Metas) {
 		return false
 	}
@@ -345,6 +357,42 @@ func (cfg *BaseProxyConf) compare(cmp *BaseProxyConf) bool {
 	return true
 }
 
+// resolveLocalIPInterface turns "iface:eth0" style local_ip values into the
+// interface's current address, preferring IPv4. Resolution happens when
+// configs are loaded, so a reload picks up a changed address in dynamic
+// container networks.
+func resolveLocalIPInterface(localIP string) (string, error) {
+	if !strings.HasPrefix(localIP, "iface:") {
+		return localIP, nil
+	}
+	name := strings.TrimPrefix(localIP, "iface:")
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return "", fmt.Errorf("resolve local_ip interface [%s] error: %v", name, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", fmt.Errorf("resolve local_ip interface [%s] error: %v", name, err)
+	}
+	var fallback string
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP == nil {
+			continue
+		}
+		if ip4 := ipNet.IP.To4(); ip4 != nil {
+			return ip4.String(), nil
+		}
+		if fallback == "" {
+			fallback = ipNet.IP.String()
+		}
+	}
+	if fallback == "" {
+		return "", fmt.Errorf("interface [%s] has no usable address", name)
+	}
+	return fallback, nil
+}
+
 // BaseProxyConf apply custom logic changes.
 func (cfg *BaseProxyConf) decorate(prefix string, name string, section *ini.Section) error {
 	// proxy_name
@@ -364,6 +412,13 @@ func (cfg *BaseProxyConf) decorate(prefix string, name string, section *ini.Sect
 	// plugin_xxx
 	cfg.LocalSvrConf.PluginParams = GetMapByPrefix(section.KeysHash(), "plugin_")
 
+	// local_ip = iface:<name>
+	localIP, err := resolveLocalIPInterface(cfg.LocalIP)
+	if err != nil {
+		return err
+	}
+	cfg.LocalIP = localIP
+
 	// custom logic code
 	if cfg.HealthCheckType == "tcp" && cfg.Plugin == "" {
 		cfg.HealthCheckAddr = cfg.LocalIP + fmt.Sprintf(":%d", cfg.LocalPort)
@@ -407,6 +462,13 @@ func (cfg *BaseProxyConf) checkForCli() (err error) {
 		}
 	}
 
+	if cfg.AcceptRateLimit < 0 {
+		return fmt.Errorf("accept_rate_limit should be greater than or equal to 0")
+	}
+	if cfg.AcceptRateBurst < 0 {
+		return fmt.Errorf("accept_rate_burst should be greater than or equal to 0")
+	}
+
 	if err = cfg.LocalSvrConf.checkForCli(); err != nil {
 		return
 	}
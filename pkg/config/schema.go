@@ -0,0 +1,101 @@
+// Copyright 2021 The frp Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ProxyConfSchema returns a JSON Schema object describing the fields of the
+// proxy config struct registered for proxyType, generated via reflection so
+// it can't drift from the Go structs.
+func ProxyConfSchema(proxyType string) (map[string]interface{}, error) {
+	cfg := NewConfByType(proxyType)
+	if cfg == nil {
+		return nil, fmt.Errorf("proxy type [%s] error", proxyType)
+	}
+	return structSchema(reflect.TypeOf(cfg).Elem()), nil
+}
+
+// VisitorConfSchema is the visitor counterpart of ProxyConfSchema.
+func VisitorConfSchema(visitorType string) (map[string]interface{}, error) {
+	cfg := DefaultVisitorConf(visitorType)
+	if cfg == nil {
+		return nil, fmt.Errorf("visitor type [%s] error", visitorType)
+	}
+	return structSchema(reflect.TypeOf(cfg).Elem()), nil
+}
+
+func structSchema(t reflect.Type) map[string]interface{} {
+	props := make(map[string]interface{})
+	collectFieldSchemas(t, props)
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": props,
+	}
+}
+
+// collectFieldSchemas walks a struct type, flattening embedded structs the
+// same way encoding/json does, keyed by the json tag names.
+func collectFieldSchemas(t reflect.Type, props map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && ft.Kind() == reflect.Struct {
+			collectFieldSchemas(ft, props)
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		props[name] = fieldSchema(ft)
+	}
+}
+
+func fieldSchema(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return fieldSchema(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{
+			"type":  "array",
+			"items": fieldSchema(t.Elem()),
+		}
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": fieldSchema(t.Elem()),
+		}
+	case reflect.Struct:
+		return structSchema(t)
+	default:
+		return map[string]interface{}{}
+	}
+}
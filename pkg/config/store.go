@@ -0,0 +1,1205 @@
+// Copyright 2021 The frp Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatedier/frp/pkg/consts"
+
+	"gopkg.in/ini.v1"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	// ErrStoreNotFound is returned when a store entry doesn't exist.
+	ErrStoreNotFound = errors.New("store entry not found")
+	// ErrStoreConflict is returned when a store entry already exists.
+	ErrStoreConflict = errors.New("store entry already exists")
+	// ErrStoreRevisionMismatch is returned by conditional updates when the
+	// entry changed since the expected revision was read.
+	ErrStoreRevisionMismatch = errors.New("store entry revision mismatch")
+)
+
+// StoreProxyEntry is one proxy record in the store. Conf keeps the
+// configuration exactly as it was submitted through the admin API; runtime
+// defaults are only injected when the entry is turned into a ProxyConf.
+type StoreProxyEntry struct {
+	Name string          `json:"name"`
+	Conf json.RawMessage `json:"conf"`
+	// Description is a free-form operator comment, mirrored from the
+	// "description" field of the submitted config so UIs can show it without
+	// digging into the raw JSON.
+	Description string `json:"description,omitempty"`
+	// Revision starts at 1 and is incremented on every change to the entry,
+	// enabling conditional updates.
+	Revision uint64 `json:"revision"`
+}
+
+// StoreVisitorEntry is one visitor record in the store.
+type StoreVisitorEntry struct {
+	Name        string          `json:"name"`
+	Conf        json.RawMessage `json:"conf"`
+	Description string          `json:"description,omitempty"`
+	Revision    uint64          `json:"revision"`
+}
+
+// storeEntryDescription returns the free-form "description" field of a raw
+// store config, or "" if absent.
+func storeEntryDescription(raw json.RawMessage) string {
+	var peek struct {
+		Description string `json:"description"`
+	}
+	if err := json.Unmarshal(raw, &peek); err != nil {
+		return ""
+	}
+	return peek.Description
+}
+
+func newStoreProxyEntry(name string, conf json.RawMessage, revision uint64) *StoreProxyEntry {
+	return &StoreProxyEntry{Name: name, Conf: conf, Description: storeEntryDescription(conf), Revision: revision}
+}
+
+func newStoreVisitorEntry(name string, conf json.RawMessage, revision uint64) *StoreVisitorEntry {
+	return &StoreVisitorEntry{Name: name, Conf: conf, Description: storeEntryDescription(conf), Revision: revision}
+}
+
+type storeFile struct {
+	Proxies  []*StoreProxyEntry   `json:"proxies"`
+	Visitors []*StoreVisitorEntry `json:"visitors"`
+}
+
+// Store file formats.
+const (
+	StoreFormatJSON = "json"
+	StoreFormatYAML = "yaml"
+	// StoreFormatSQLite keeps the entries in a sqlite database instead of a
+	// flat file; mutations commit in a transaction, so a crash mid-write
+	// keeps the previous state rather than a truncated file.
+	StoreFormatSQLite = "sqlite"
+)
+
+// StoreSource persists proxy and visitor configs edited through the admin
+// API to a single JSON or YAML file, keeping entries in insertion order.
+type StoreSource struct {
+	path   string
+	format string
+
+	// renderEnvs applies the same template pass as file configs to raw
+	// entries when building runtime configs; the stored value keeps its
+	// placeholders either way.
+	renderEnvs bool
+
+	proxies  []*StoreProxyEntry
+	visitors []*StoreVisitorEntry
+	mu       sync.RWMutex
+
+	// rev counts store mutations; the GetAll caches below stay valid until
+	// it moves, so repeated snapshot reads during reloads don't re-clone the
+	// entry slices.
+	rev             uint64
+	proxyCache      []*StoreProxyEntry
+	proxyCacheRev   uint64
+	visitorCache    []*StoreVisitorEntry
+	visitorCacheRev uint64
+}
+
+// SetRenderEnvs toggles environment-variable interpolation of store configs
+// at reload time. It is opt-in via store_render_envs.
+func (s *StoreSource) SetRenderEnvs(enable bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.renderEnvs = enable
+}
+
+// renderEntryConf returns the config to build runtime state from, applying
+// the template pass when enabled and resolving secret references. Callers
+// must hold s.mu.
+func (s *StoreSource) renderEntryConf(raw json.RawMessage) (json.RawMessage, error) {
+	if s.renderEnvs {
+		out, err := RenderContent(raw)
+		if err != nil {
+			return nil, fmt.Errorf("render store config error: %v", err)
+		}
+		raw = out
+	}
+	return resolveSecretRefs(raw)
+}
+
+// resolveSecretRefs replaces string values of the form "env:NAME" or
+// "file:/path" with the referenced content, so sensitive fields like sk or
+// http_pwd can be kept out of the persisted store. References resolve fresh
+// on every build; an unset variable or unreadable file fails the build. The
+// stored config always keeps the reference, never the resolved value.
+func resolveSecretRefs(raw json.RawMessage) (json.RawMessage, error) {
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, err
+	}
+	resolved, changed, err := resolveSecretValue(v)
+	if err != nil {
+		return nil, err
+	}
+	if !changed {
+		return raw, nil
+	}
+	return json.Marshal(resolved)
+}
+
+func resolveSecretValue(v interface{}) (interface{}, bool, error) {
+	switch t := v.(type) {
+	case string:
+		if name := strings.TrimPrefix(t, "env:"); name != t {
+			val, ok := os.LookupEnv(name)
+			if !ok {
+				return nil, false, fmt.Errorf("secret reference [%s]: environment variable not set", t)
+			}
+			return val, true, nil
+		}
+		if path := strings.TrimPrefix(t, "file:"); path != t {
+			buf, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, false, fmt.Errorf("secret reference [%s]: %v", t, err)
+			}
+			// a trailing newline is almost always an artifact of how the
+			// secret file was written
+			return strings.TrimRight(string(buf), "\r\n"), true, nil
+		}
+		return t, false, nil
+	case map[string]interface{}:
+		changed := false
+		for k, val := range t {
+			resolved, c, err := resolveSecretValue(val)
+			if err != nil {
+				return nil, false, err
+			}
+			if c {
+				t[k] = resolved
+				changed = true
+			}
+		}
+		return t, changed, nil
+	case []interface{}:
+		changed := false
+		for i, val := range t {
+			resolved, c, err := resolveSecretValue(val)
+			if err != nil {
+				return nil, false, err
+			}
+			if c {
+				t[i] = resolved
+				changed = true
+			}
+		}
+		return t, changed, nil
+	default:
+		return v, false, nil
+	}
+}
+
+// StoreStats summarizes the persisted store: entry counts plus size and
+// last-modified time of the backing file.
+type StoreStats struct {
+	ProxyCount    int       `json:"proxy_count"`
+	VisitorCount  int       `json:"visitor_count"`
+	FileSizeBytes int64     `json:"file_size_bytes"`
+	LastModified  time.Time `json:"last_modified"`
+}
+
+// Stats reports the current store statistics. A store whose backing file
+// hasn't been created yet reports zero size and time.
+func (s *StoreSource) Stats() (StoreStats, error) {
+	s.mu.RLock()
+	stats := StoreStats{
+		ProxyCount:   len(s.proxies),
+		VisitorCount: len(s.visitors),
+	}
+	path := s.path
+	s.mu.RUnlock()
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return stats, nil
+		}
+		return stats, err
+	}
+	stats.FileSizeBytes = fi.Size()
+	stats.LastModified = fi.ModTime()
+	return stats, nil
+}
+
+// NewStoreSource creates a store backed by the file at path, loading any
+// entries already persisted there. The format is inferred from the file
+// extension, defaulting to JSON. Only a missing or empty file is treated as
+// an empty store; a file that exists but fails to parse — truncated by a
+// crashed write, for example — is a hard error, so a corrupt store refuses
+// to load instead of silently dropping every entry.
+func NewStoreSource(path string) (*StoreSource, error) {
+	format := StoreFormatJSON
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		format = StoreFormatYAML
+	case ".db", ".sqlite", ".sqlite3":
+		format = StoreFormatSQLite
+	}
+	return NewStoreSourceWithFormat(path, format)
+}
+
+// NewStoreSourceFromRemote bootstraps a store from a remote JSON or YAML
+// definition, persisting the fetched entries to the local file at path.
+// When the fetch or parse fails and a local store file already exists, the
+// local contents are used so a flaky definition server doesn't take the
+// client down.
+func NewStoreSourceFromRemote(path, remoteURL string) (*StoreSource, error) {
+	local, localErr := NewStoreSource(path)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(remoteURL)
+	if err != nil {
+		return storeRemoteFallback(local, localErr, remoteURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return storeRemoteFallback(local, localErr, remoteURL, fmt.Errorf("unexpected status [%s]", resp.Status))
+	}
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return storeRemoteFallback(local, localErr, remoteURL, err)
+	}
+
+	format := StoreFormatJSON
+	switch strings.ToLower(filepath.Ext(remoteURL)) {
+	case ".yaml", ".yml":
+		format = StoreFormatYAML
+	}
+	f, err := unmarshalStoreFile(content, format)
+	if err != nil {
+		return storeRemoteFallback(local, localErr, remoteURL, err)
+	}
+
+	if localErr != nil {
+		return nil, localErr
+	}
+	local.mu.Lock()
+	defer local.mu.Unlock()
+	local.proxies = f.Proxies
+	local.visitors = f.Visitors
+	if err := local.persist(); err != nil {
+		return nil, err
+	}
+	return local, nil
+}
+
+func storeRemoteFallback(local *StoreSource, localErr error, remoteURL string, fetchErr error) (*StoreSource, error) {
+	if localErr != nil {
+		return nil, fmt.Errorf("fetch remote store %s error: %v", remoteURL, fetchErr)
+	}
+	return local, nil
+}
+
+// NewStoreSourceWithFormat creates a store with an explicit file format:
+// "json", "yaml" or "sqlite".
+func NewStoreSourceWithFormat(path, format string) (*StoreSource, error) {
+	if format != StoreFormatJSON && format != StoreFormatYAML && format != StoreFormatSQLite {
+		return nil, fmt.Errorf("unsupported store format [%s]", format)
+	}
+	s := &StoreSource{
+		path:     path,
+		format:   format,
+		proxies:  make([]*StoreProxyEntry, 0),
+		visitors: make([]*StoreVisitorEntry, 0),
+	}
+	if format == StoreFormatSQLite {
+		f, err := loadStoreSQLite(path)
+		if err != nil {
+			return nil, fmt.Errorf("load store database %s error: %v", path, err)
+		}
+		s.proxies = f.Proxies
+		s.visitors = f.Visitors
+		return s, nil
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, err
+	}
+	if len(content) == 0 {
+		return s, nil
+	}
+
+	f, err := unmarshalStoreFile(content, format)
+	if err != nil {
+		return nil, fmt.Errorf("parse store file %s error: %v", path, err)
+	}
+	if f.Proxies != nil {
+		s.proxies = f.Proxies
+	}
+	if f.Visitors != nil {
+		s.visitors = f.Visitors
+	}
+	return s, nil
+}
+
+// persist writes the current entries back to the store file. It must be
+// called with the lock held. Multi-entry mutations (group toggles, RemoveAll,
+// Restore) go through here; single-entry ones use persistProxyRow and
+// persistVisitorRow so the sqlite backend can touch just the affected row.
+func (s *StoreSource) persist() error {
+	s.rev++
+	if s.format == StoreFormatSQLite {
+		return persistStoreSQLite(s.path, &storeFile{
+			Proxies:  s.proxies,
+			Visitors: s.visitors,
+		})
+	}
+	buf, err := marshalStoreFile(&storeFile{
+		Proxies:  s.proxies,
+		Visitors: s.visitors,
+	}, s.format)
+	if err != nil {
+		return err
+	}
+	return writeStoreFileAtomic(s.path, buf)
+}
+
+// writeStoreFileAtomic writes buf to a temp file next to path, syncs it and
+// renames it into place. Since a truncated store file refuses to load, a
+// crash mid-write must never leave one behind.
+func writeStoreFileAtomic(path string, buf []byte) error {
+	tmpFile, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmpFile.Name()
+	if _, err = tmpFile.Write(buf); err == nil {
+		err = tmpFile.Sync()
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpPath, 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// persistProxyRow persists a change to one proxy entry. The sqlite backend
+// executes a single indexed statement; the file formats can only rewrite the
+// whole file and fall through to persist. Deletes pass a nil entry, renames
+// the old name in oldName. Must be called with the lock held.
+func (s *StoreSource) persistProxyRow(op, oldName string, e *StoreProxyEntry) error {
+	if s.format != StoreFormatSQLite {
+		return s.persist()
+	}
+	var name string
+	var conf json.RawMessage
+	var revision uint64
+	if e != nil {
+		name, conf, revision = e.Name, e.Conf, e.Revision
+	}
+	return s.persistRow("proxies", op, oldName, name, conf, revision)
+}
+
+// persistVisitorRow is persistProxyRow for visitor entries.
+func (s *StoreSource) persistVisitorRow(op, oldName string, e *StoreVisitorEntry) error {
+	if s.format != StoreFormatSQLite {
+		return s.persist()
+	}
+	var name string
+	var conf json.RawMessage
+	var revision uint64
+	if e != nil {
+		name, conf, revision = e.Name, e.Conf, e.Revision
+	}
+	return s.persistRow("visitors", op, oldName, name, conf, revision)
+}
+
+func (s *StoreSource) persistRow(table, op, oldName, name string, conf json.RawMessage, revision uint64) error {
+	s.rev++
+	err := persistStoreRow(s.path, table, op, oldName, name, conf, revision)
+	if err == errStoreRowMissing {
+		// The database drifted from the in-memory entries (edited out from
+		// under us); rewrite it wholesale to converge.
+		return persistStoreSQLite(s.path, &storeFile{
+			Proxies:  s.proxies,
+			Visitors: s.visitors,
+		})
+	}
+	return err
+}
+
+// storeYamlFile mirrors storeFile with configs as generic maps, since raw
+// JSON messages don't serialize meaningfully as YAML.
+type storeYamlFile struct {
+	Proxies  []*storeYamlEntry `yaml:"proxies"`
+	Visitors []*storeYamlEntry `yaml:"visitors"`
+}
+
+type storeYamlEntry struct {
+	Name     string                 `yaml:"name"`
+	Conf     map[string]interface{} `yaml:"conf"`
+	Revision uint64                 `yaml:"revision"`
+}
+
+func marshalStoreFile(f *storeFile, format string) ([]byte, error) {
+	if format == StoreFormatJSON {
+		return json.MarshalIndent(f, "", "    ")
+	}
+
+	yf := &storeYamlFile{
+		Proxies:  make([]*storeYamlEntry, 0, len(f.Proxies)),
+		Visitors: make([]*storeYamlEntry, 0, len(f.Visitors)),
+	}
+	for _, e := range f.Proxies {
+		ye, err := newStoreYamlEntry(e.Name, e.Conf, e.Revision)
+		if err != nil {
+			return nil, err
+		}
+		yf.Proxies = append(yf.Proxies, ye)
+	}
+	for _, e := range f.Visitors {
+		ye, err := newStoreYamlEntry(e.Name, e.Conf, e.Revision)
+		if err != nil {
+			return nil, err
+		}
+		yf.Visitors = append(yf.Visitors, ye)
+	}
+	return yaml.Marshal(yf)
+}
+
+func unmarshalStoreFile(content []byte, format string) (*storeFile, error) {
+	if format == StoreFormatJSON {
+		var f storeFile
+		if err := json.Unmarshal(content, &f); err != nil {
+			return nil, err
+		}
+		return &f, nil
+	}
+
+	var yf storeYamlFile
+	if err := yaml.Unmarshal(content, &yf); err != nil {
+		return nil, err
+	}
+	f := &storeFile{
+		Proxies:  make([]*StoreProxyEntry, 0, len(yf.Proxies)),
+		Visitors: make([]*StoreVisitorEntry, 0, len(yf.Visitors)),
+	}
+	for _, ye := range yf.Proxies {
+		conf, err := json.Marshal(yamlValueToJSON(ye.Conf))
+		if err != nil {
+			return nil, err
+		}
+		f.Proxies = append(f.Proxies, newStoreProxyEntry(ye.Name, conf, ye.Revision))
+	}
+	for _, ye := range yf.Visitors {
+		conf, err := json.Marshal(yamlValueToJSON(ye.Conf))
+		if err != nil {
+			return nil, err
+		}
+		f.Visitors = append(f.Visitors, newStoreVisitorEntry(ye.Name, conf, ye.Revision))
+	}
+	return f, nil
+}
+
+func newStoreYamlEntry(name string, conf json.RawMessage, revision uint64) (*storeYamlEntry, error) {
+	var m map[string]interface{}
+	if err := json.Unmarshal(conf, &m); err != nil {
+		return nil, fmt.Errorf("entry [%s]: %v", name, err)
+	}
+	return &storeYamlEntry{Name: name, Conf: m, Revision: revision}, nil
+}
+
+// yamlValueToJSON rewrites the map[interface{}]interface{} values produced by
+// the yaml decoder into map[string]interface{} so they can be re-encoded as
+// JSON.
+func yamlValueToJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			m[fmt.Sprintf("%v", k)] = yamlValueToJSON(item)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			m[k] = yamlValueToJSON(item)
+		}
+		return m
+	case []interface{}:
+		items := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			items = append(items, yamlValueToJSON(item))
+		}
+		return items
+	default:
+		return v
+	}
+}
+
+func (s *StoreSource) findProxy(name string) int {
+	for i, e := range s.proxies {
+		if e.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *StoreSource) findVisitor(name string) int {
+	for i, e := range s.visitors {
+		if e.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// AddProxy adds a proxy entry. Names are unique across proxies and
+// visitors: anything that keys store entries by name alone (status
+// annotations, webhooks) would silently conflate a proxy and a visitor
+// sharing one.
+func (s *StoreSource) AddProxy(name string, conf json.RawMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.findProxy(name) != -1 {
+		return fmt.Errorf("proxy [%s]: %w", name, ErrStoreConflict)
+	}
+	if s.findVisitor(name) != -1 {
+		return fmt.Errorf("a visitor named [%s] already exists: %w", name, ErrStoreConflict)
+	}
+	e := newStoreProxyEntry(name, conf, 1)
+	s.proxies = append(s.proxies, e)
+	return s.persistProxyRow(storeRowInsert, "", e)
+}
+
+func (s *StoreSource) GetProxy(name string) (json.RawMessage, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if i := s.findProxy(name); i != -1 {
+		return s.proxies[i].Conf, true
+	}
+	return nil, false
+}
+
+// GetProxyEntry returns a copy of the full proxy record, including its
+// revision.
+func (s *StoreSource) GetProxyEntry(name string) (StoreProxyEntry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if i := s.findProxy(name); i != -1 {
+		return *s.proxies[i], true
+	}
+	return StoreProxyEntry{}, false
+}
+
+func (s *StoreSource) UpdateProxy(name string, conf json.RawMessage) error {
+	return s.UpdateProxyWithRevision(name, conf, 0)
+}
+
+// UpdateProxyWithRevision updates a proxy entry only if its current revision
+// matches expectedRevision; 0 skips the check. Entries are replaced rather
+// than mutated so snapshots taken before the update stay intact.
+func (s *StoreSource) UpdateProxyWithRevision(name string, conf json.RawMessage, expectedRevision uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.findProxy(name)
+	if i == -1 {
+		return fmt.Errorf("proxy [%s]: %w", name, ErrStoreNotFound)
+	}
+	if expectedRevision != 0 && s.proxies[i].Revision != expectedRevision {
+		return fmt.Errorf("proxy [%s] is at revision %d, not %d: %w",
+			name, s.proxies[i].Revision, expectedRevision, ErrStoreRevisionMismatch)
+	}
+	s.proxies[i] = newStoreProxyEntry(name, conf, s.proxies[i].Revision+1)
+	return s.persistProxyRow(storeRowUpdate, name, s.proxies[i])
+}
+
+func (s *StoreSource) RemoveProxy(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.findProxy(name)
+	if i == -1 {
+		return fmt.Errorf("proxy [%s]: %w", name, ErrStoreNotFound)
+	}
+	s.proxies = append(s.proxies[:i], s.proxies[i+1:]...)
+	return s.persistProxyRow(storeRowDelete, name, nil)
+}
+
+// RenameProxy renames a proxy entry in place, preserving its position in
+// the persisted file. The name embedded in the stored config is updated to
+// match.
+func (s *StoreSource) RenameProxy(oldName, newName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.findProxy(oldName)
+	if i == -1 {
+		return fmt.Errorf("proxy [%s]: %w", oldName, ErrStoreNotFound)
+	}
+	if s.findProxy(newName) != -1 {
+		return fmt.Errorf("proxy [%s]: %w", newName, ErrStoreConflict)
+	}
+	if s.findVisitor(newName) != -1 {
+		return fmt.Errorf("a visitor named [%s] already exists: %w", newName, ErrStoreConflict)
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(s.proxies[i].Conf, &m); err != nil {
+		return err
+	}
+	m["name"] = newName
+	conf, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	s.proxies[i] = newStoreProxyEntry(newName, conf, s.proxies[i].Revision+1)
+	return s.persistProxyRow(storeRowUpdate, oldName, s.proxies[i])
+}
+
+// SetProxyEnabled flips only the "enabled" field of a proxy entry, leaving
+// every other field as submitted. An absent field counts as enabled.
+func (s *StoreSource) SetProxyEnabled(name string, enabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.findProxy(name)
+	if i == -1 {
+		return fmt.Errorf("proxy [%s]: %w", name, ErrStoreNotFound)
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(s.proxies[i].Conf, &m); err != nil {
+		return err
+	}
+	m["enabled"] = enabled
+	conf, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	s.proxies[i] = newStoreProxyEntry(name, conf, s.proxies[i].Revision+1)
+	return s.persistProxyRow(storeRowUpdate, name, s.proxies[i])
+}
+
+// SetProxyHealthCheckEnabled flips only the "health_check_enabled" field of
+// a proxy entry, so a flaky backend's health check can be suppressed without
+// touching the rest of the config. Proxies without a health check configured
+// are reported as not found.
+func (s *StoreSource) SetProxyHealthCheckEnabled(name string, enabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.findProxy(name)
+	if i == -1 {
+		return fmt.Errorf("proxy [%s]: %w", name, ErrStoreNotFound)
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(s.proxies[i].Conf, &m); err != nil {
+		return err
+	}
+	if t, _ := m["health_check_type"].(string); t == "" {
+		return fmt.Errorf("proxy [%s] has no health check config: %w", name, ErrStoreNotFound)
+	}
+	m["health_check_enabled"] = enabled
+	conf, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	s.proxies[i] = newStoreProxyEntry(name, conf, s.proxies[i].Revision+1)
+	return s.persistProxyRow(storeRowUpdate, name, s.proxies[i])
+}
+
+// StoreDefaultGroup is the group that proxies without an explicit "group"
+// field belong to.
+const StoreDefaultGroup = "default"
+
+// storeEntryGroup returns the group of a raw store config.
+func storeEntryGroup(raw json.RawMessage) string {
+	var peek struct {
+		Group string `json:"group"`
+	}
+	if err := json.Unmarshal(raw, &peek); err != nil || peek.Group == "" {
+		return StoreDefaultGroup
+	}
+	return peek.Group
+}
+
+// GetProxyGroups returns the distinct groups of all proxy entries, sorted.
+func (s *StoreSource) GetProxyGroups() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	seen := make(map[string]struct{})
+	groups := make([]string, 0)
+	for _, e := range s.proxies {
+		group := storeEntryGroup(e.Conf)
+		if _, ok := seen[group]; !ok {
+			seen[group] = struct{}{}
+			groups = append(groups, group)
+		}
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// SetGroupEnabled flips the "enabled" field of every proxy in a group in one
+// pass, persisting once.
+func (s *StoreSource) SetGroupEnabled(group string, enabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	found := false
+	for i, e := range s.proxies {
+		if storeEntryGroup(e.Conf) != group {
+			continue
+		}
+		found = true
+
+		var m map[string]interface{}
+		if err := json.Unmarshal(e.Conf, &m); err != nil {
+			return err
+		}
+		m["enabled"] = enabled
+		conf, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		s.proxies[i] = newStoreProxyEntry(e.Name, conf, e.Revision+1)
+	}
+	if !found {
+		return fmt.Errorf("group [%s]: %w", group, ErrStoreNotFound)
+	}
+	return s.persist()
+}
+
+// storeEntryEnabled reports whether a raw store config is enabled; entries
+// without an "enabled" field are enabled.
+func storeEntryEnabled(raw json.RawMessage) bool {
+	var peek struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := json.Unmarshal(raw, &peek); err != nil {
+		return true
+	}
+	return peek.Enabled == nil || *peek.Enabled
+}
+
+// GetAllProxyNames returns only the proxy entry names, in insertion order,
+// without touching the stored configs.
+func (s *StoreSource) GetAllProxyNames() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.proxies))
+	for _, e := range s.proxies {
+		names = append(names, e.Name)
+	}
+	return names
+}
+
+// GetAllProxies returns all proxy entries in insertion order, which is also
+// the order persisted on disk. The returned slice is shared with subsequent
+// calls until the next mutation and must not be modified.
+func (s *StoreSource) GetAllProxies() []*StoreProxyEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.proxyCache == nil || s.proxyCacheRev != s.rev {
+		entries := make([]*StoreProxyEntry, len(s.proxies))
+		copy(entries, s.proxies)
+		s.proxyCache = entries
+		s.proxyCacheRev = s.rev
+	}
+	return s.proxyCache
+}
+
+// RemoveAll deletes every proxy and visitor entry in a single persist. It is
+// used by the replace-store endpoint before re-adding the desired state.
+func (s *StoreSource) RemoveAll() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.proxies = nil
+	s.visitors = nil
+	return s.persist()
+}
+
+// AddVisitor adds a visitor entry, enforcing the same cross-entity name
+// uniqueness as AddProxy.
+func (s *StoreSource) AddVisitor(name string, conf json.RawMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.findVisitor(name) != -1 {
+		return fmt.Errorf("visitor [%s]: %w", name, ErrStoreConflict)
+	}
+	if s.findProxy(name) != -1 {
+		return fmt.Errorf("a proxy named [%s] already exists: %w", name, ErrStoreConflict)
+	}
+	e := newStoreVisitorEntry(name, conf, 1)
+	s.visitors = append(s.visitors, e)
+	return s.persistVisitorRow(storeRowInsert, "", e)
+}
+
+func (s *StoreSource) GetVisitor(name string) (json.RawMessage, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if i := s.findVisitor(name); i != -1 {
+		return s.visitors[i].Conf, true
+	}
+	return nil, false
+}
+
+func (s *StoreSource) UpdateVisitor(name string, conf json.RawMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.findVisitor(name)
+	if i == -1 {
+		return fmt.Errorf("visitor [%s]: %w", name, ErrStoreNotFound)
+	}
+	s.visitors[i] = newStoreVisitorEntry(name, conf, s.visitors[i].Revision+1)
+	return s.persistVisitorRow(storeRowUpdate, name, s.visitors[i])
+}
+
+func (s *StoreSource) RemoveVisitor(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.findVisitor(name)
+	if i == -1 {
+		return fmt.Errorf("visitor [%s]: %w", name, ErrStoreNotFound)
+	}
+	s.visitors = append(s.visitors[:i], s.visitors[i+1:]...)
+	return s.persistVisitorRow(storeRowDelete, name, nil)
+}
+
+// GetAllVisitors returns all visitor entries, cached the same way as
+// GetAllProxies.
+func (s *StoreSource) GetAllVisitors() []*StoreVisitorEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.visitorCache == nil || s.visitorCacheRev != s.rev {
+		entries := make([]*StoreVisitorEntry, len(s.visitors))
+		copy(entries, s.visitors)
+		s.visitorCache = entries
+		s.visitorCacheRev = s.rev
+	}
+	return s.visitorCache
+}
+
+// ExportJSON serializes the store contents in the same layout as the store
+// file itself.
+func (s *StoreSource) ExportJSON() ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return json.MarshalIndent(&storeFile{
+		Proxies:  s.proxies,
+		Visitors: s.visitors,
+	}, "", "    ")
+}
+
+// ExportIni serializes the store contents as an ini document matching the
+// frpc config file layout, one section per entry.
+func (s *StoreSource) ExportIni() ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	f := ini.Empty()
+	for _, e := range s.proxies {
+		if err := storeConfToIniSection(f, e.Name, e.Conf); err != nil {
+			return nil, fmt.Errorf("export proxy [%s] error: %v", e.Name, err)
+		}
+	}
+	for _, e := range s.visitors {
+		if err := storeConfToIniSection(f, e.Name, e.Conf); err != nil {
+			return nil, fmt.Errorf("export visitor [%s] error: %v", e.Name, err)
+		}
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if _, err := f.WriteTo(buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// storeConfToIniSection writes one raw store config as an ini section. The
+// json field names of the config structs match their ini key names, so the
+// raw JSON object can be mapped key by key; map-valued fields use the same
+// key prefixes as the ini loader.
+func storeConfToIniSection(f *ini.File, name string, raw json.RawMessage) error {
+	var m map[string]interface{}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return err
+	}
+	delete(m, "name")
+
+	sec, err := f.NewSection(name)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		switch v := m[k].(type) {
+		case string:
+			sec.NewKey(k, v)
+		case bool:
+			sec.NewKey(k, strconv.FormatBool(v))
+		case float64:
+			sec.NewKey(k, strconv.FormatFloat(v, 'f', -1, 64))
+		case []interface{}:
+			parts := make([]string, 0, len(v))
+			for _, item := range v {
+				parts = append(parts, fmt.Sprintf("%v", item))
+			}
+			sec.NewKey(k, strings.Join(parts, ","))
+		case map[string]interface{}:
+			prefix := ""
+			switch k {
+			case "metas":
+				prefix = "meta_"
+			case "headers":
+				prefix = "header_"
+			default:
+				continue
+			}
+			subKeys := make([]string, 0, len(v))
+			for sk := range v {
+				subKeys = append(subKeys, sk)
+			}
+			sort.Strings(subKeys)
+			for _, sk := range subKeys {
+				sec.NewKey(prefix+sk, fmt.Sprintf("%v", v[sk]))
+			}
+		}
+	}
+	return nil
+}
+
+// StoreSnapshot holds a copy of the store contents so a failed mutation can
+// be rolled back.
+type StoreSnapshot struct {
+	proxies  []*StoreProxyEntry
+	visitors []*StoreVisitorEntry
+}
+
+func (s *StoreSource) Snapshot() *StoreSnapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	snap := &StoreSnapshot{
+		proxies:  make([]*StoreProxyEntry, len(s.proxies)),
+		visitors: make([]*StoreVisitorEntry, len(s.visitors)),
+	}
+	copy(snap.proxies, s.proxies)
+	copy(snap.visitors, s.visitors)
+	return snap
+}
+
+func (s *StoreSource) Restore(snap *StoreSnapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.proxies = snap.proxies
+	s.visitors = snap.visitors
+	return s.persist()
+}
+
+// BuildProxyConfs hydrates all proxy entries into validated proxy configs,
+// keyed and name-prefixed the same way as configs loaded from the
+// configuration file.
+func (s *StoreSource) BuildProxyConfs(user string) (map[string]ProxyConf, error) {
+	prefix := user
+	if prefix != "" {
+		if err := ValidateUserName(prefix); err != nil {
+			return nil, err
+		}
+		prefix += proxyNameSeparator
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pxyCfgs := make(map[string]ProxyConf)
+	for _, e := range s.proxies {
+		if !storeEntryEnabled(e.Conf) {
+			continue
+		}
+		raw, err := s.renderEntryConf(e.Conf)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render store proxy %s, err: %v", e.Name, err)
+		}
+		cfg, err := NewProxyConfFromJSON(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse store proxy %s, err: %v", e.Name, err)
+		}
+		cfg.GetBaseInfo().ProxyName = prefix + e.Name
+		pxyCfgs[prefix+e.Name] = cfg
+	}
+	return pxyCfgs, nil
+}
+
+// BuildVisitorConfs hydrates all visitor entries into validated visitor
+// configs, keyed and name-prefixed the same way as configs loaded from the
+// configuration file.
+func (s *StoreSource) BuildVisitorConfs(user string) (map[string]VisitorConf, error) {
+	prefix := user
+	if prefix != "" {
+		if err := ValidateUserName(prefix); err != nil {
+			return nil, err
+		}
+		prefix += proxyNameSeparator
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	visitorCfgs := make(map[string]VisitorConf)
+	for _, e := range s.visitors {
+		if !storeEntryEnabled(e.Conf) {
+			continue
+		}
+		raw, err := s.renderEntryConf(e.Conf)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render store visitor %s, err: %v", e.Name, err)
+		}
+		cfg, err := NewVisitorConfFromJSON(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse store visitor %s, err: %v", e.Name, err)
+		}
+		base := cfg.GetBaseInfo()
+		base.ProxyName = prefix + e.Name
+		base.ServerName = prefix + base.ServerName
+		visitorCfgs[prefix+e.Name] = cfg
+	}
+	return visitorCfgs, nil
+}
+
+// NewProxyConfFromJSON creates a client proxy config from a JSON object such
+// as the ones accepted by the admin API store endpoints. Defaults are
+// injected the same way as for configs loaded from ini.
+func NewProxyConfFromJSON(raw []byte) (ProxyConf, error) {
+	var peek struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(raw, &peek); err != nil {
+		return nil, err
+	}
+	if peek.Type == "" {
+		peek.Type = consts.TCPProxy
+	}
+
+	conf := DefaultProxyConf(peek.Type)
+	if conf == nil {
+		return nil, fmt.Errorf("proxy %s has invalid type [%s]", peek.Name, peek.Type)
+	}
+	if err := json.Unmarshal(raw, conf); err != nil {
+		return nil, err
+	}
+
+	// replicate the custom decoration done when loading from ini
+	base := conf.GetBaseInfo()
+	localIP, err := resolveLocalIPInterface(base.LocalIP)
+	if err != nil {
+		return nil, err
+	}
+	base.LocalIP = localIP
+	// a suppressed health check behaves as if none were configured, while
+	// the stored config keeps its health check section
+	var hcPeek struct {
+		HealthCheckEnabled *bool `json:"health_check_enabled"`
+	}
+	if err := json.Unmarshal(raw, &hcPeek); err == nil &&
+		hcPeek.HealthCheckEnabled != nil && !*hcPeek.HealthCheckEnabled {
+		base.HealthCheckType = ""
+	}
+	if base.HealthCheckType == "tcp" && base.Plugin == "" {
+		base.HealthCheckAddr = base.LocalIP + fmt.Sprintf(":%d", base.LocalPort)
+	}
+	if base.HealthCheckType == "http" && base.Plugin == "" && base.HealthCheckURL != "" &&
+		!strings.HasPrefix(base.HealthCheckURL, "http://") {
+		s := fmt.Sprintf("http://%s:%d", base.LocalIP, base.LocalPort)
+		if !strings.HasPrefix(base.HealthCheckURL, "/") {
+			s += "/"
+		}
+		base.HealthCheckURL = s + base.HealthCheckURL
+	}
+
+	if err := conf.CheckForCli(); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// NewVisitorConfFromJSON creates a visitor config from a JSON object such as
+// the ones accepted by the admin API store endpoints.
+func NewVisitorConfFromJSON(raw []byte) (VisitorConf, error) {
+	var peek struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(raw, &peek); err != nil {
+		return nil, err
+	}
+	if peek.Type == "" {
+		return nil, fmt.Errorf("visitor [%s] type shouldn't be empty", peek.Name)
+	}
+
+	conf := DefaultVisitorConf(peek.Type)
+	if conf == nil {
+		return nil, fmt.Errorf("visitor [%s] type [%s] error", peek.Name, peek.Type)
+	}
+	if err := json.Unmarshal(raw, conf); err != nil {
+		return nil, err
+	}
+
+	// replicate the custom decoration done when loading from ini
+	base := conf.GetBaseInfo()
+	if base.Role == "" {
+		base.Role = "visitor"
+	}
+	if base.BindAddr == "" {
+		base.BindAddr = "127.0.0.1"
+	}
+
+	if err := conf.Check(); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
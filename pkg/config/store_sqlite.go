@@ -0,0 +1,250 @@
+// Copyright 2021 The frp Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// The sqlite backend loads the whole store once at startup, like the file
+// formats, but persists single-entry mutations as one statement against the
+// affected row (keyed by the unique name index) instead of rewriting
+// everything. What it buys over the file formats is crash safety — a killed
+// write leaves the previous committed state instead of a truncated file.
+// The driver is pure Go, so cross-compiled builds stay cgo-free.
+const sqliteStoreSchema = `
+CREATE TABLE IF NOT EXISTS proxies (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE,
+	conf TEXT NOT NULL,
+	revision INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS visitors (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE,
+	conf TEXT NOT NULL,
+	revision INTEGER NOT NULL
+);
+`
+
+func openStoreDB(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(sqliteStoreSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// loadStoreSQLite reads all entries from the store database at path, creating
+// an empty one if the file does not exist yet. Entries come back in insertion
+// order, matching the file formats. When the database is created for the
+// first time and a JSON store file with the same base name exists alongside
+// it, its entries are imported, so switching store_format to sqlite keeps the
+// existing store.
+func loadStoreSQLite(path string) (*storeFile, error) {
+	_, statErr := os.Stat(path)
+	firstOpen := os.IsNotExist(statErr)
+
+	db, err := openStoreDB(path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	if firstOpen {
+		if err := importStoreJSON(db, path); err != nil {
+			return nil, err
+		}
+	}
+
+	f := &storeFile{
+		Proxies:  make([]*StoreProxyEntry, 0),
+		Visitors: make([]*StoreVisitorEntry, 0),
+	}
+	err = queryStoreRows(db, "proxies", func(name string, conf json.RawMessage, revision uint64) {
+		f.Proxies = append(f.Proxies, newStoreProxyEntry(name, conf, revision))
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = queryStoreRows(db, "visitors", func(name string, conf json.RawMessage, revision uint64) {
+		f.Visitors = append(f.Visitors, newStoreVisitorEntry(name, conf, revision))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func queryStoreRows(db *sql.DB, table string, add func(name string, conf json.RawMessage, revision uint64)) error {
+	rows, err := db.Query(fmt.Sprintf("SELECT name, conf, revision FROM %s ORDER BY id", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			name     string
+			conf     string
+			revision int64
+		)
+		if err := rows.Scan(&name, &conf, &revision); err != nil {
+			return err
+		}
+		add(name, json.RawMessage(conf), uint64(revision))
+	}
+	return rows.Err()
+}
+
+// importStoreJSON copies the entries of a sibling JSON store file (the
+// database path with its extension swapped for ".json") into a freshly
+// created database. The JSON file itself is left untouched; since the import
+// only runs when the database file is absent, it happens at most once.
+func importStoreJSON(db *sql.DB, dbPath string) error {
+	jsonPath := strings.TrimSuffix(dbPath, filepath.Ext(dbPath)) + ".json"
+	content, err := ioutil.ReadFile(jsonPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if len(content) == 0 {
+		return nil
+	}
+	f, err := unmarshalStoreFile(content, StoreFormatJSON)
+	if err != nil {
+		return fmt.Errorf("import store file %s error: %v", jsonPath, err)
+	}
+	return persistStoreFile(db, f)
+}
+
+// Row operations understood by persistStoreRow.
+const (
+	storeRowInsert = "insert"
+	storeRowUpdate = "update"
+	storeRowDelete = "delete"
+)
+
+// errStoreRowMissing reports that an update or delete matched no row: the
+// database no longer agrees with the in-memory entries.
+var errStoreRowMissing = errors.New("store row not found in database")
+
+// persistStoreRow applies a single-entry mutation as one statement against
+// the row identified by oldName, using the unique index on name rather than
+// rewriting the tables. Inserts ignore oldName; renames carry the old name in
+// oldName and the new one in name.
+func persistStoreRow(path, table, op, oldName, name string, conf json.RawMessage, revision uint64) error {
+	db, err := openStoreDB(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var res sql.Result
+	switch op {
+	case storeRowInsert:
+		res, err = db.Exec(
+			fmt.Sprintf("INSERT INTO %s (name, conf, revision) VALUES (?, ?, ?)", table),
+			name, string(conf), int64(revision))
+	case storeRowUpdate:
+		res, err = db.Exec(
+			fmt.Sprintf("UPDATE %s SET name = ?, conf = ?, revision = ? WHERE name = ?", table),
+			name, string(conf), int64(revision), oldName)
+	case storeRowDelete:
+		res, err = db.Exec(fmt.Sprintf("DELETE FROM %s WHERE name = ?", table), oldName)
+	default:
+		return fmt.Errorf("unknown store row operation [%s]", op)
+	}
+	if err != nil {
+		return err
+	}
+	if op != storeRowInsert {
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return errStoreRowMissing
+		}
+	}
+	return nil
+}
+
+// persistStoreSQLite replaces the database contents with the given entries in
+// a single transaction, so a crash mid-write keeps the previous state. It is
+// the fallback for multi-entry mutations; single-entry ones go through
+// persistStoreRow.
+func persistStoreSQLite(path string, f *storeFile) error {
+	db, err := openStoreDB(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return persistStoreFile(db, f)
+}
+
+func persistStoreFile(db *sql.DB, f *storeFile) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := persistStoreTable(tx, "proxies", len(f.Proxies), func(i int) (string, json.RawMessage, uint64) {
+		e := f.Proxies[i]
+		return e.Name, e.Conf, e.Revision
+	}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := persistStoreTable(tx, "visitors", len(f.Visitors), func(i int) (string, json.RawMessage, uint64) {
+		e := f.Visitors[i]
+		return e.Name, e.Conf, e.Revision
+	}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func persistStoreTable(tx *sql.Tx, table string, count int, entry func(i int) (string, json.RawMessage, uint64)) error {
+	if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s", table)); err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(fmt.Sprintf("INSERT INTO %s (name, conf, revision) VALUES (?, ?, ?)", table))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for i := 0; i < count; i++ {
+		name, conf, revision := entry(i)
+		if _, err := stmt.Exec(name, string(conf), int64(revision)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
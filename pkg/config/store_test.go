@@ -0,0 +1,337 @@
+// Copyright 2021 The frp Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStoreSourceRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "store.json")
+	s, err := NewStoreSource(path)
+	assert.NoError(err)
+
+	conf := json.RawMessage(`{"name":"ssh","type":"tcp","local_port":22,"remote_port":6000}`)
+	assert.NoError(s.AddProxy("ssh", conf))
+	assert.True(errors.Is(s.AddProxy("ssh", conf), ErrStoreConflict))
+
+	// reload from the persisted file
+	s2, err := NewStoreSource(path)
+	assert.NoError(err)
+	raw, ok := s2.GetProxy("ssh")
+	assert.True(ok)
+	assert.JSONEq(string(conf), string(raw))
+
+	assert.True(errors.Is(s2.RemoveProxy("unknown"), ErrStoreNotFound))
+
+	// the description field is surfaced on the entry itself
+	withDesc := json.RawMessage(`{"name":"web","type":"tcp","local_port":80,"remote_port":8080,"description":"legacy intranet app"}`)
+	assert.NoError(s2.AddProxy("web", withDesc))
+	entry, ok := s2.GetProxyEntry("web")
+	assert.True(ok)
+	assert.Equal("legacy intranet app", entry.Description)
+}
+
+func TestStoreSourceConditionalUpdate(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := NewStoreSource(filepath.Join(t.TempDir(), "store.json"))
+	assert.NoError(err)
+
+	conf := json.RawMessage(`{"name":"ssh","type":"tcp","local_port":22,"remote_port":6000}`)
+	assert.NoError(s.AddProxy("ssh", conf))
+	entry, ok := s.GetProxyEntry("ssh")
+	assert.True(ok)
+	assert.EqualValues(1, entry.Revision)
+
+	// stale revision is rejected, matching revision bumps it
+	assert.True(errors.Is(s.UpdateProxyWithRevision("ssh", conf, 5), ErrStoreRevisionMismatch))
+	assert.NoError(s.UpdateProxyWithRevision("ssh", conf, 1))
+	entry, _ = s.GetProxyEntry("ssh")
+	assert.EqualValues(2, entry.Revision)
+}
+
+func TestStoreSourceYAMLRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "store.yaml")
+	s, err := NewStoreSource(path)
+	assert.NoError(err)
+
+	conf := json.RawMessage(`{"name":"ssh","type":"tcp","local_port":22,"remote_port":6000,"metas":{"k1":"v1"}}`)
+	assert.NoError(s.AddProxy("ssh", conf))
+
+	// reload from the persisted yaml file
+	s2, err := NewStoreSource(path)
+	assert.NoError(err)
+	raw, ok := s2.GetProxy("ssh")
+	assert.True(ok)
+	assert.JSONEq(string(conf), string(raw))
+
+	_, err = NewStoreSourceWithFormat(path, "toml")
+	assert.Error(err)
+}
+
+func TestStoreSourceSQLiteRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "store.db")
+	s, err := NewStoreSource(path)
+	assert.NoError(err)
+
+	conf := json.RawMessage(`{"name":"ssh","type":"tcp","local_port":22,"remote_port":6000,"description":"via sqlite"}`)
+	assert.NoError(s.AddProxy("ssh", conf))
+	assert.NoError(s.AddVisitor("v1", json.RawMessage(`{"name":"v1","type":"stcp","server_name":"ssh","sk":"abc","bind_port":9000}`)))
+
+	// reload from the persisted database
+	s2, err := NewStoreSource(path)
+	assert.NoError(err)
+	raw, ok := s2.GetProxy("ssh")
+	assert.True(ok)
+	assert.JSONEq(string(conf), string(raw))
+	entry, ok := s2.GetProxyEntry("ssh")
+	assert.True(ok)
+	assert.EqualValues(1, entry.Revision)
+	assert.Equal("via sqlite", entry.Description)
+	assert.Len(s2.GetAllVisitors(), 1)
+
+	// a file that is not a sqlite database refuses to load
+	bad := filepath.Join(t.TempDir(), "bad.db")
+	assert.NoError(ioutil.WriteFile(bad, []byte("not a database"), 0644))
+	_, err = NewStoreSource(bad)
+	assert.Error(err)
+}
+
+func TestStoreSourceSQLiteRowMutations(t *testing.T) {
+	assert := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "store.db")
+	s, err := NewStoreSource(path)
+	assert.NoError(err)
+
+	assert.NoError(s.AddProxy("ssh", json.RawMessage(`{"name":"ssh","type":"tcp","local_port":22,"remote_port":6000}`)))
+	assert.NoError(s.AddProxy("web", json.RawMessage(`{"name":"web","type":"tcp","local_port":80,"remote_port":8080}`)))
+	assert.NoError(s.UpdateProxy("web", json.RawMessage(`{"name":"web","type":"tcp","local_port":81,"remote_port":8080}`)))
+	assert.NoError(s.RenameProxy("ssh", "ssh2"))
+	assert.NoError(s.RemoveProxy("web"))
+	assert.NoError(s.SetProxyEnabled("ssh2", false))
+
+	// every row mutation above must be visible on a fresh load
+	s2, err := NewStoreSource(path)
+	assert.NoError(err)
+	assert.Equal([]string{"ssh2"}, s2.GetAllProxyNames())
+	entry, ok := s2.GetProxyEntry("ssh2")
+	assert.True(ok)
+	assert.EqualValues(3, entry.Revision)
+	raw, _ := s2.GetProxy("ssh2")
+	assert.False(storeEntryEnabled(raw))
+}
+
+func TestStoreSourceSQLiteImportFromJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	jsonStore, err := NewStoreSource(filepath.Join(dir, "store.json"))
+	assert.NoError(err)
+	conf := json.RawMessage(`{"name":"ssh","type":"tcp","local_port":22,"remote_port":6000}`)
+	assert.NoError(jsonStore.AddProxy("ssh", conf))
+
+	// a fresh database next to the json file imports its entries
+	dbPath := filepath.Join(dir, "store.db")
+	s, err := NewStoreSource(dbPath)
+	assert.NoError(err)
+	raw, ok := s.GetProxy("ssh")
+	assert.True(ok)
+	assert.JSONEq(string(conf), string(raw))
+
+	// the import runs only once: entries removed from the database do not
+	// come back from the json file on the next open
+	assert.NoError(s.RemoveProxy("ssh"))
+	s2, err := NewStoreSource(dbPath)
+	assert.NoError(err)
+	assert.Len(s2.GetAllProxyNames(), 0)
+}
+
+func TestStoreSourceBuildProxyConfs(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := NewStoreSource(filepath.Join(t.TempDir(), "store.json"))
+	assert.NoError(err)
+
+	conf := json.RawMessage(`{"name":"ssh","type":"tcp","local_port":22,"remote_port":6000}`)
+	assert.NoError(s.AddProxy("ssh", conf))
+
+	pxyCfgs, err := s.BuildProxyConfs("user1")
+	assert.NoError(err)
+	assert.Len(pxyCfgs, 1)
+
+	cfg, ok := pxyCfgs["user1.ssh"].(*TCPProxyConf)
+	assert.True(ok)
+	assert.Equal("user1.ssh", cfg.ProxyName)
+	// runtime defaults are injected on build but never persisted
+	assert.Equal("127.0.0.1", cfg.LocalIP)
+	raw, _ := s.GetProxy("ssh")
+	assert.JSONEq(string(conf), string(raw))
+}
+
+func TestStoreSourceExportRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := NewStoreSource(filepath.Join(t.TempDir(), "store.json"))
+	assert.NoError(err)
+
+	conf := json.RawMessage(`{"name":"ssh","type":"tcp","local_ip":"127.0.0.1","local_port":22,"remote_port":6000}`)
+	assert.NoError(s.AddProxy("ssh", conf))
+
+	content, err := s.ExportIni()
+	assert.NoError(err)
+
+	pxyCfgs, _, err := LoadAllProxyConfsFromIni("", content, nil)
+	assert.NoError(err)
+	assert.Len(pxyCfgs, 1)
+
+	storeCfgs, err := s.BuildProxyConfs("")
+	assert.NoError(err)
+	assert.True(storeCfgs["ssh"].Compare(pxyCfgs["ssh"]))
+}
+
+func TestStoreSourceTCPHealthCheck(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := NewStoreSource(filepath.Join(t.TempDir(), "store.json"))
+	assert.NoError(err)
+
+	// a tcp health check on a store proxy passes validation and survives the
+	// build, so the health monitor will dial the backend periodically
+	conf := json.RawMessage(`{"name":"ssh","type":"tcp","local_port":22,"remote_port":6000,` +
+		`"health_check_type":"tcp","health_check_timeout_s":3,"health_check_max_failed":3,"health_check_interval_s":10}`)
+	assert.NoError(s.AddProxy("ssh", conf))
+
+	pxyCfgs, err := s.BuildProxyConfs("")
+	assert.NoError(err)
+	cfg, ok := pxyCfgs["ssh"].(*TCPProxyConf)
+	assert.True(ok)
+	assert.Equal("tcp", cfg.HealthCheckType)
+	assert.Equal(10, cfg.HealthCheckIntervalS)
+
+	// unknown health check types are rejected up front
+	_, err = NewProxyConfFromJSON([]byte(`{"name":"bad","type":"tcp","local_port":22,"remote_port":6001,"health_check_type":"icmp"}`))
+	assert.Error(err)
+}
+
+func TestStoreCrossEntityNameUniqueness(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := NewStoreSource(filepath.Join(t.TempDir(), "store.json"))
+	assert.NoError(err)
+
+	// names are unique across proxies and visitors, so anything keyed by
+	// name alone can't conflate the two
+	assert.NoError(s.AddProxy("shared", json.RawMessage(`{"name":"shared","type":"tcp","local_port":22,"remote_port":6000}`)))
+	err = s.AddVisitor("shared", json.RawMessage(`{"name":"shared","type":"stcp","server_name":"shared","sk":"abc","bind_port":9000}`))
+	assert.True(errors.Is(err, ErrStoreConflict))
+
+	assert.NoError(s.AddVisitor("v1", json.RawMessage(`{"name":"v1","type":"stcp","server_name":"shared","sk":"abc","bind_port":9000}`)))
+	err = s.AddProxy("v1", json.RawMessage(`{"name":"v1","type":"tcp","local_port":22,"remote_port":6001}`))
+	assert.True(errors.Is(err, ErrStoreConflict))
+
+	// renaming a proxy onto a visitor's name is refused too
+	err = s.RenameProxy("shared", "v1")
+	assert.True(errors.Is(err, ErrStoreConflict))
+}
+
+func TestStoreSourceCorruptFile(t *testing.T) {
+	assert := assert.New(t)
+
+	// a truncated store file must refuse to load rather than come up as an
+	// empty store and drop every entry on the next persist
+	path := filepath.Join(t.TempDir(), "store.json")
+	assert.NoError(ioutil.WriteFile(path, []byte(`{"proxies":[{"name":"ssh","conf":{"name":"ssh"`), 0644))
+
+	_, err := NewStoreSource(path)
+	assert.Error(err)
+
+	// a missing or empty file is still a valid empty store
+	assert.NoError(ioutil.WriteFile(path, []byte(""), 0644))
+	s, err := NewStoreSource(path)
+	assert.NoError(err)
+	assert.Len(s.GetAllProxies(), 0)
+}
+
+func TestStoreSecretRefs(t *testing.T) {
+	assert := assert.New(t)
+
+	os.Setenv("FRP_TEST_SK", "supersecret")
+	defer os.Unsetenv("FRP_TEST_SK")
+
+	s, err := NewStoreSource(filepath.Join(t.TempDir(), "store.json"))
+	assert.NoError(err)
+
+	conf := json.RawMessage(`{"name":"secret_tcp","type":"stcp","sk":"env:FRP_TEST_SK","local_port":22}`)
+	assert.NoError(s.AddProxy("secret_tcp", conf))
+
+	// the built config carries the resolved secret, the stored entry keeps
+	// the reference
+	pxyCfgs, err := s.BuildProxyConfs("")
+	assert.NoError(err)
+	cfg, ok := pxyCfgs["secret_tcp"].(*STCPProxyConf)
+	assert.True(ok)
+	assert.Equal("supersecret", cfg.Sk)
+	entry, ok := s.GetProxyEntry("secret_tcp")
+	assert.True(ok)
+	assert.Contains(string(entry.Conf), "env:FRP_TEST_SK")
+
+	// an unset variable fails the build instead of running with an empty key
+	assert.NoError(s.AddProxy("broken", json.RawMessage(`{"name":"broken","type":"stcp","sk":"env:FRP_TEST_MISSING","local_port":22}`)))
+	_, err = s.BuildProxyConfs("")
+	assert.Error(err)
+}
+
+func TestNewProxyConfFromJSONInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewProxyConfFromJSON([]byte(`{"name":"p1","type":"wrong"}`))
+	assert.Error(err)
+}
+
+func BenchmarkStoreSourceGetAllProxies(b *testing.B) {
+	s, err := NewStoreSource(filepath.Join(b.TempDir(), "store.json"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		name := fmt.Sprintf("proxy-%d", i)
+		conf := json.RawMessage(fmt.Sprintf(`{"name":%q,"type":"tcp","local_port":22,"remote_port":%d}`, name, 10000+i))
+		if err := s.AddProxy(name, conf); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if got := s.GetAllProxies(); len(got) != 1000 {
+			b.Fatalf("unexpected entry count %d", len(got))
+		}
+	}
+}
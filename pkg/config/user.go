@@ -0,0 +1,60 @@
+// Copyright 2021 The frp Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// proxyNameSeparator is inserted between the user name and proxy names when
+// building the full proxy name sent to the server.
+var proxyNameSeparator = "."
+
+// SetProxyNameSeparator overrides the separator used between user name and
+// proxy names, for deployments whose proxy names legitimately contain dots.
+// It must be configured consistently on the client and the server side.
+func SetProxyNameSeparator(sep string) {
+	proxyNameSeparator = sep
+}
+
+// FullProxyName prefixes a proxy name with the user name, producing the
+// name the proxy runs under. An empty user leaves the name untouched.
+func FullProxyName(user, name string) string {
+	if user == "" {
+		return name
+	}
+	return user + proxyNameSeparator + name
+}
+
+// userNameDisallowedChars are characters that would be ambiguous inside a
+// prefixed proxy name regardless of the configured separator: they commonly
+// act as separators elsewhere (urls, file paths).
+const userNameDisallowedChars = "/\\ "
+
+// ValidateUserName checks that a user name is safe to use as a proxy name
+// prefix. An empty user is allowed and simply means no prefix is applied.
+func ValidateUserName(user string) error {
+	if user == "" {
+		return nil
+	}
+	if strings.Contains(user, proxyNameSeparator) {
+		return fmt.Errorf("invalid user name [%s]: separator [%s] is not allowed", user, proxyNameSeparator)
+	}
+	if idx := strings.IndexAny(user, userNameDisallowedChars); idx >= 0 {
+		return fmt.Errorf("invalid user name [%s]: character [%c] is not allowed", user, user[idx])
+	}
+	return nil
+}
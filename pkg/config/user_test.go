@@ -0,0 +1,56 @@
+// Copyright 2021 The frp Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateUserName(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, user := range []string{"", "alice", "alice-01", "alice_bob"} {
+		assert.NoError(ValidateUserName(user), "user [%s]", user)
+	}
+
+	for _, user := range []string{"alice.bob", "alice/bob", "alice bob", "alice\\bob"} {
+		assert.Error(ValidateUserName(user), "user [%s]", user)
+	}
+}
+
+func TestProxyNameSeparator(t *testing.T) {
+	assert := assert.New(t)
+
+	SetProxyNameSeparator("/")
+	defer SetProxyNameSeparator(".")
+
+	// "." is now a legitimate proxy-name character while "/" is the delimiter
+	assert.NoError(ValidateUserName("alice.bob"))
+	assert.Error(ValidateUserName("alice/bob"))
+
+	content := `
+[ssh]
+type = tcp
+local_port = 22
+remote_port = 6000
+`
+	pxyCfgs, _, err := LoadAllProxyConfsFromIni("alice", []byte(content), nil)
+	assert.NoError(err)
+	if assert.Contains(pxyCfgs, "alice/ssh") {
+		assert.Equal("alice/ssh", pxyCfgs["alice/ssh"].GetBaseInfo().ProxyName)
+	}
+}
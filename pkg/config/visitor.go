@@ -49,6 +49,24 @@ type BaseVisitorConf struct {
 	ServerName     string `ini:"server_name" json:"server_name"`
 	BindAddr       string `ini:"bind_addr" json:"bind_addr"`
 	BindPort       int    `ini:"bind_port" json:"bind_port"`
+	// DialTimeoutS bounds the handshake with the server when a user
+	// connection comes in, in seconds. 0 keeps the default of 10 seconds.
+	DialTimeoutS int `ini:"dial_timeout_s" json:"dial_timeout_s"`
+	// KeepAliveS sets the TCP keepalive period of accepted user connections
+	// in seconds. 0 keeps the operating system default.
+	KeepAliveS int `ini:"keep_alive_s" json:"keep_alive_s"`
+	// ReconnectIntervalS is the pause between reconnect attempts to the
+	// server, in seconds. 0 keeps the default of 3 seconds.
+	ReconnectIntervalS int `ini:"reconnect_interval_s" json:"reconnect_interval_s"`
+	// ReconnectMaxRetries caps consecutive failed reconnect attempts before
+	// the visitor gives up. 0 means retry forever.
+	ReconnectMaxRetries int `ini:"reconnect_max_retries" json:"reconnect_max_retries"`
+	// Plugin names a visitor-side plugin that takes over accepted local
+	// connections instead of raw forwarding. Empty means no plugin.
+	Plugin string `ini:"plugin" json:"plugin"`
+	// PluginParams specify parameters to be passed to the plugin, if one is
+	// used.
+	PluginParams map[string]string `ini:"-"`
 }
 
 type SUDPVisitorConf struct {
@@ -113,7 +131,13 @@ func (cfg *BaseVisitorConf) compare(cmp *BaseVisitorConf) bool {
 		cfg.Sk != cmp.Sk ||
 		cfg.ServerName != cmp.ServerName ||
 		cfg.BindAddr != cmp.BindAddr ||
-		cfg.BindPort != cmp.BindPort {
+		cfg.BindPort != cmp.BindPort ||
+		cfg.DialTimeoutS != cmp.DialTimeoutS ||
+		cfg.KeepAliveS != cmp.KeepAliveS ||
+		cfg.ReconnectIntervalS != cmp.ReconnectIntervalS ||
+		cfg.ReconnectMaxRetries != cmp.ReconnectMaxRetries ||
+		cfg.Plugin != cmp.Plugin ||
+		!reflect.DeepEqual(cfg.PluginParams, cmp.PluginParams) {
 		return false
 	}
 	return true
@@ -132,6 +156,22 @@ func (cfg *BaseVisitorConf) check() (err error) {
 		err = fmt.Errorf("bind_port is required")
 		return
 	}
+	if cfg.DialTimeoutS < 0 {
+		err = fmt.Errorf("dial_timeout_s shouldn't be negative")
+		return
+	}
+	if cfg.KeepAliveS < 0 {
+		err = fmt.Errorf("keep_alive_s shouldn't be negative")
+		return
+	}
+	if cfg.ReconnectIntervalS < 0 {
+		err = fmt.Errorf("reconnect_interval_s shouldn't be negative")
+		return
+	}
+	if cfg.ReconnectMaxRetries < 0 {
+		err = fmt.Errorf("reconnect_max_retries shouldn't be negative")
+		return
+	}
 	return
 }
 
@@ -149,6 +189,9 @@ func (cfg *BaseVisitorConf) unmarshalFromIni(prefix string, name string, section
 		cfg.BindAddr = "127.0.0.1"
 	}
 
+	// plugin_xxx
+	cfg.PluginParams = GetMapByPrefix(section.KeysHash(), "plugin_")
+
 	return nil
 }
 
@@ -201,6 +244,11 @@ func (cfg *SUDPVisitorConf) Check() (err error) {
 	}
 
 	// Add custom logic validate, if exists
+	// visitor plugins work on byte streams, which a sudp visitor doesn't carry
+	if cfg.Plugin != "" {
+		err = fmt.Errorf("plugin is not supported for sudp visitor")
+		return
+	}
 
 	return
 }
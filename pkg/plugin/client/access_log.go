@@ -0,0 +1,88 @@
+// Copyright 2021 The frp Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fatedier/frp/pkg/util/log"
+)
+
+// parsePluginEnableAccessLog parses the optional plugin_enable_access_log
+// parameter shared by the reverse proxy plugins, defaulting to false.
+func parsePluginEnableAccessLog(params map[string]string) (bool, error) {
+	str := params["plugin_enable_access_log"]
+	if str == "" {
+		return false, nil
+	}
+	enable, err := strconv.ParseBool(str)
+	if err != nil {
+		return false, fmt.Errorf("invalid plugin_enable_access_log [%s]", str)
+	}
+	return enable, nil
+}
+
+// accessLogResponseWriter records the status code and body bytes written by
+// the wrapped handler.
+type accessLogResponseWriter struct {
+	http.ResponseWriter
+
+	statusCode int
+	bytes      int64
+}
+
+func (w *accessLogResponseWriter) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *accessLogResponseWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *accessLogResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack exposes the underlying connection; httputil.ReverseProxy needs it to
+// relay upgraded (websocket) connections. Bytes written after the hijack are
+// not counted.
+func (w *accessLogResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, fmt.Errorf("response writer does not support hijacking")
+}
+
+// makeHTTPAccessLogHandler logs one line per request with method, path,
+// status, duration and response bytes, for auditing which requests actually
+// reach the backend.
+func makeHTTPAccessLogHandler(pluginName string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lw := &accessLogResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		start := time.Now()
+		h.ServeHTTP(lw, r)
+		log.Info("[%s] %s %s %d %v %d", pluginName, r.Method, r.URL.Path, lw.statusCode, time.Since(start), lw.bytes)
+	})
+}
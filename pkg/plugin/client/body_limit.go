@@ -0,0 +1,111 @@
+// Copyright 2021 The frp Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var errResponseBodyTooLarge = errors.New("response body too large")
+
+// parsePluginMaxBodySizes reads plugin_max_request_body_size and
+// plugin_max_response_body_size in bytes. 0 (the default) means unlimited.
+func parsePluginMaxBodySizes(params map[string]string) (maxReq int64, maxResp int64, err error) {
+	if str := params["plugin_max_request_body_size"]; str != "" {
+		maxReq, err = strconv.ParseInt(str, 10, 64)
+		if err != nil || maxReq < 0 {
+			return 0, 0, fmt.Errorf("invalid plugin_max_request_body_size [%s]", str)
+		}
+	}
+	if str := params["plugin_max_response_body_size"]; str != "" {
+		maxResp, err = strconv.ParseInt(str, 10, 64)
+		if err != nil || maxResp < 0 {
+			return 0, 0, fmt.Errorf("invalid plugin_max_response_body_size [%s]", str)
+		}
+	}
+	return maxReq, maxResp, nil
+}
+
+// makeHTTPRequestBodyLimitHandler rejects requests whose body exceeds max
+// bytes with 413. Oversized bodies without a Content-Length are caught by
+// http.MaxBytesReader while the reverse proxy reads them.
+func makeHTTPRequestBodyLimitHandler(h http.Handler, max int64) http.Handler {
+	if max <= 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > max {
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, max)
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// limitResponseBody enforces max bytes on a proxied response. A declared
+// oversized Content-Length fails immediately so the error handler can still
+// answer 413; responses that only exceed the limit mid-stream abort the
+// transfer instead.
+func limitResponseBody(resp *http.Response, max int64) error {
+	if max <= 0 {
+		return nil
+	}
+	if resp.ContentLength > max {
+		resp.Body.Close()
+		return errResponseBodyTooLarge
+	}
+	resp.Body = &limitedBody{rc: resp.Body, remaining: max}
+	return nil
+}
+
+type limitedBody struct {
+	rc        io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.rc.Read(p)
+	if int64(n) > b.remaining {
+		b.remaining = 0
+		return 0, errResponseBodyTooLarge
+	}
+	b.remaining -= int64(n)
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	return b.rc.Close()
+}
+
+// bodyLimitErrorHandler maps body-limit errors to 413 and everything else to
+// the reverse proxy's usual 502.
+func bodyLimitErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, errResponseBodyTooLarge) || strings.Contains(err.Error(), "request body too large") {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+	w.WriteHeader(http.StatusBadGateway)
+}
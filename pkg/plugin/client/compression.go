@@ -0,0 +1,198 @@
+// Copyright 2021 The frp Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// parsePluginEnableCompression parses the optional plugin_enable_compression
+// parameter shared by the reverse proxy plugins, defaulting to false.
+func parsePluginEnableCompression(params map[string]string) (bool, error) {
+	str := params["plugin_enable_compression"]
+	if str == "" {
+		return false, nil
+	}
+	enable, err := strconv.ParseBool(str)
+	if err != nil {
+		return false, fmt.Errorf("invalid plugin_enable_compression [%s]", str)
+	}
+	return enable, nil
+}
+
+// parsePluginCompressionAlgorithms parses the optional
+// plugin_compression_algorithms parameter: a comma-separated, preference-
+// ordered list of response encodings used when compression is enabled.
+// Supported algorithms are "gzip" and "br"; the default is gzip only.
+func parsePluginCompressionAlgorithms(params map[string]string) ([]string, error) {
+	str := params["plugin_compression_algorithms"]
+	if str == "" {
+		return []string{"gzip"}, nil
+	}
+	algorithms := make([]string, 0, 2)
+	for _, algo := range strings.Split(str, ",") {
+		switch algo = strings.TrimSpace(algo); algo {
+		case "gzip", "br":
+			algorithms = append(algorithms, algo)
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown compression algorithm [%s]", algo)
+		}
+	}
+	if len(algorithms) == 0 {
+		return nil, fmt.Errorf("plugin_compression_algorithms shouldn't be empty")
+	}
+	return algorithms, nil
+}
+
+// incompressibleContentTypes lists content type prefixes that are already
+// compressed, where another gzip pass only wastes CPU.
+var incompressibleContentTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"font/",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/pdf",
+	"application/octet-stream",
+}
+
+func compressibleContentType(contentType string) bool {
+	for _, prefix := range incompressibleContentTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// makeHTTPCompressionHandler compresses responses for clients, picking the
+// first configured algorithm the client accepts; unlike
+// frpNet.MakeHTTPGzipHandler it skips responses that are already encoded or
+// whose content type is compressed by nature.
+func makeHTTPCompressionHandler(h http.Handler, algorithms []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// upgrade requests (websockets) switch protocols and hijack the
+		// connection; compressing them would corrupt the byte stream
+		encoding := pickContentEncoding(r.Header.Get("Accept-Encoding"), algorithms)
+		if encoding == "" || r.Header.Get("Upgrade") != "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressionResponseWriter{ResponseWriter: w, encoding: encoding}
+		defer cw.close()
+		h.ServeHTTP(cw, r)
+	})
+}
+
+// pickContentEncoding returns the first configured algorithm listed in the
+// Accept-Encoding header, or "" when none is. Quality values are ignored, as
+// they were in the gzip-only version of this handler.
+func pickContentEncoding(acceptEncoding string, algorithms []string) string {
+	accepted := make(map[string]bool)
+	for _, token := range strings.Split(acceptEncoding, ",") {
+		if i := strings.Index(token, ";"); i >= 0 {
+			token = token[:i]
+		}
+		if token = strings.TrimSpace(token); token != "" {
+			accepted[token] = true
+		}
+	}
+	for _, algo := range algorithms {
+		if accepted[algo] {
+			return algo
+		}
+	}
+	return ""
+}
+
+// compressionResponseWriter decides whether to compress when the response
+// headers are written, since only then the content type and encoding are
+// known.
+type compressionResponseWriter struct {
+	http.ResponseWriter
+
+	encoding    string
+	cw          io.WriteCloser
+	wroteHeader bool
+}
+
+func (w *compressionResponseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	h := w.Header()
+	if h.Get("Content-Encoding") == "" && compressibleContentType(h.Get("Content-Type")) {
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+		if w.encoding == "br" {
+			w.cw = brotli.NewWriter(w.ResponseWriter)
+		} else {
+			w.cw = gzip.NewWriter(w.ResponseWriter)
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *compressionResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.cw != nil {
+		return w.cw.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *compressionResponseWriter) close() {
+	if w.cw != nil {
+		w.cw.Close()
+	}
+}
+
+// Flush pushes buffered compressed data out so streaming responses (SSE,
+// chunked transfers) make progress instead of stalling in the compressor.
+func (w *compressionResponseWriter) Flush() {
+	if w.cw != nil {
+		if f, ok := w.cw.(interface{ Flush() error }); ok {
+			f.Flush()
+		}
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack exposes the underlying connection; httputil.ReverseProxy needs it to
+// relay upgraded (websocket) connections.
+func (w *compressionResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, fmt.Errorf("response writer does not support hijacking")
+}
@@ -0,0 +1,133 @@
+// Copyright 2021 The frp Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const PluginDNS2DOH = "dns2doh"
+
+func init() {
+	Register(PluginDNS2DOH, NewDNS2DOHPlugin)
+}
+
+// DNS2DOHPlugin accepts DNS queries with the two bytes length prefix used by
+// DNS over TCP and relays each of them as a RFC 8484 POST request to the
+// configured DNS-over-HTTPS server, writing back the wire-format response.
+type DNS2DOHPlugin struct {
+	upstreamURL string
+
+	client *http.Client
+}
+
+func NewDNS2DOHPlugin(params map[string]string) (Plugin, error) {
+	upstreamURL := params["plugin_upstream_url"]
+	timeoutStr := params["plugin_timeout"]
+
+	if upstreamURL == "" {
+		return nil, fmt.Errorf("plugin_upstream_url is required")
+	}
+	u, err := url.Parse(upstreamURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("plugin_upstream_url should be a valid https URL")
+	}
+
+	var timeout time.Duration
+	if timeoutStr != "" {
+		timeout, err = time.ParseDuration(timeoutStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid plugin_timeout [%s]: %v", timeoutStr, err)
+		}
+	}
+
+	p := &DNS2DOHPlugin{
+		upstreamURL: upstreamURL,
+		client: &http.Client{
+			Timeout: timeout,
+		},
+	}
+	return p, nil
+}
+
+func (p *DNS2DOHPlugin) Handle(conn io.ReadWriteCloser, realConn net.Conn, extraBufToLocal []byte) {
+	defer conn.Close()
+
+	var rd io.Reader = conn
+	if len(extraBufToLocal) > 0 {
+		rd = io.MultiReader(bytes.NewReader(extraBufToLocal), conn)
+	}
+
+	lenBuf := make([]byte, 2)
+	for {
+		if _, err := io.ReadFull(rd, lenBuf); err != nil {
+			return
+		}
+		length := binary.BigEndian.Uint16(lenBuf)
+		if length == 0 {
+			return
+		}
+		queryBuf := make([]byte, length)
+		if _, err := io.ReadFull(rd, queryBuf); err != nil {
+			return
+		}
+
+		answer, err := p.forward(queryBuf)
+		if err != nil {
+			return
+		}
+		binary.BigEndian.PutUint16(lenBuf, uint16(len(answer)))
+		if _, err := conn.Write(append(lenBuf, answer...)); err != nil {
+			return
+		}
+	}
+}
+
+func (p *DNS2DOHPlugin) forward(query []byte) ([]byte, error) {
+	resp, err := p.client.Post(p.upstreamURL, "application/dns-message", bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("doh server return status code %d", resp.StatusCode)
+	}
+	// the length of a DNS message is limited by the two bytes length prefix
+	answer, err := ioutil.ReadAll(io.LimitReader(resp.Body, 65535+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(answer) > 65535 {
+		return nil, fmt.Errorf("doh response too large")
+	}
+	return answer, nil
+}
+
+func (p *DNS2DOHPlugin) Name() string {
+	return PluginDNS2DOH
+}
+
+func (p *DNS2DOHPlugin) Close() error {
+	return nil
+}
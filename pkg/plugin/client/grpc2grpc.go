@@ -0,0 +1,122 @@
+// Copyright 2021 The frp Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+
+	frpNet "github.com/fatedier/frp/pkg/util/net"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+const PluginGRPC2GRPC = "grpc2grpc"
+
+func init() {
+	Register(PluginGRPC2GRPC, NewGRPC2GRPCPlugin)
+}
+
+// GRPC2GRPCPlugin proxies gRPC to a local backend over HTTP/2, preserving
+// trailers and long-lived streams that the HTTP/1.1 reverse-proxy plugins
+// would break. With h2c enabled (the default) the backend is dialed over
+// cleartext HTTP/2; otherwise HTTP/2 over TLS is used.
+type GRPC2GRPCPlugin struct {
+	localAddr string
+	enableH2C bool
+
+	l *Listener
+	s *http.Server
+}
+
+func NewGRPC2GRPCPlugin(params map[string]string) (Plugin, error) {
+	localAddr := params["plugin_local_addr"]
+	if localAddr == "" {
+		return nil, fmt.Errorf("plugin_local_addr is required")
+	}
+
+	enableH2C := true
+	if str := params["plugin_enable_h2c"]; str != "" {
+		v, err := strconv.ParseBool(str)
+		if err != nil {
+			return nil, fmt.Errorf("invalid plugin_enable_h2c [%s]", str)
+		}
+		enableH2C = v
+	}
+
+	listener := NewProxyListener()
+
+	p := &GRPC2GRPCPlugin{
+		localAddr: localAddr,
+		enableH2C: enableH2C,
+
+		l: listener,
+	}
+
+	var tr http.RoundTripper
+	scheme := "https"
+	if enableH2C {
+		scheme = "http"
+		tr = &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+				return net.Dial(network, addr)
+			},
+		}
+	} else {
+		tr = &http2.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}
+	}
+
+	rp := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = scheme
+			req.URL.Host = p.localAddr
+		},
+		// gRPC streams both directions until completion; disable buffering
+		FlushInterval: -1,
+		Transport:     tr,
+	}
+
+	// incoming connections from frp are cleartext, so serve h2c to accept
+	// HTTP/2 with prior knowledge as gRPC clients send it
+	p.s = &http.Server{
+		Handler: h2c.NewHandler(rp, &http2.Server{}),
+	}
+
+	go p.s.Serve(listener)
+
+	return p, nil
+}
+
+func (p *GRPC2GRPCPlugin) Handle(conn io.ReadWriteCloser, realConn net.Conn, extraBufToLocal []byte) {
+	wrapConn := frpNet.WrapReadWriteCloserToConn(conn, realConn)
+	p.l.PutConn(wrapConn)
+}
+
+func (p *GRPC2GRPCPlugin) Name() string {
+	return PluginGRPC2GRPC
+}
+
+func (p *GRPC2GRPCPlugin) Close() error {
+	return p.s.Close()
+}
@@ -21,7 +21,9 @@ import (
 	"net"
 	"net/http"
 	"net/http/httputil"
+	"strconv"
 	"strings"
+	"sync/atomic"
 
 	frpNet "github.com/fatedier/frp/pkg/util/net"
 )
@@ -34,16 +36,35 @@ func init() {
 
 type HTTP2HTTPSPlugin struct {
 	hostHeaderRewrite string
-	localAddr         string
+	localAddrs        []string
 	headers           map[string]string
 
+	// stickySessionCookie, when not empty, names a routing cookie that pins a
+	// browser to one backend; with a single backend it is effectively a no-op
+	stickySessionCookie string
+	nextBackend         uint64
+
+	rewriteRedirectHost string
+
+	maxResponseBodySize int64
+
 	l *Listener
 	s *http.Server
 }
 
 func NewHTTP2HTTPSPlugin(params map[string]string) (Plugin, error) {
-	localAddr := params["plugin_local_addr"]
+	localAddrs := make([]string, 0)
+	if addr := params["plugin_local_addr"]; addr != "" {
+		localAddrs = append(localAddrs, addr)
+	}
+	for _, addr := range strings.Split(params["plugin_local_addrs"], ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			localAddrs = append(localAddrs, addr)
+		}
+	}
 	hostHeaderRewrite := params["plugin_host_header_rewrite"]
+	stickySessionCookie := params["plugin_sticky_session_cookie"]
+	rewriteRedirectHost := params["plugin_rewrite_redirect_host"]
 	headers := make(map[string]string)
 	for k, v := range params {
 		if !strings.HasPrefix(k, "plugin_header_") {
@@ -54,27 +75,66 @@ func NewHTTP2HTTPSPlugin(params map[string]string) (Plugin, error) {
 		}
 	}
 
-	if localAddr == "" {
-		return nil, fmt.Errorf("plugin_local_addr is required")
+	if len(localAddrs) == 0 {
+		return nil, fmt.Errorf("plugin_local_addr or plugin_local_addrs is required")
+	}
+
+	requestTimeout, err := parsePluginRequestTimeout(params)
+	if err != nil {
+		return nil, err
+	}
+	enableCompression, err := parsePluginEnableCompression(params)
+	if err != nil {
+		return nil, err
+	}
+	var compressionAlgorithms []string
+	if enableCompression {
+		compressionAlgorithms, err = parsePluginCompressionAlgorithms(params)
+		if err != nil {
+			return nil, err
+		}
+	}
+	enableAccessLog, err := parsePluginEnableAccessLog(params)
+	if err != nil {
+		return nil, err
+	}
+	maxRequestBodySize, maxResponseBodySize, err := parsePluginMaxBodySizes(params)
+	if err != nil {
+		return nil, err
+	}
+	maintenancePageFile, maintenanceStatusCode, err := parsePluginMaintenancePage(params)
+	if err != nil {
+		return nil, err
 	}
 
 	listener := NewProxyListener()
 
 	p := &HTTP2HTTPSPlugin{
-		localAddr:         localAddr,
+		localAddrs:        localAddrs,
 		hostHeaderRewrite: hostHeaderRewrite,
 		headers:           headers,
-		l:                 listener,
+
+		stickySessionCookie: stickySessionCookie,
+
+		rewriteRedirectHost: rewriteRedirectHost,
+
+		maxResponseBodySize: maxResponseBodySize,
+
+		l: listener,
 	}
 
 	tr := &http.Transport{
 		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 	}
+	if requestTimeout > 0 {
+		tr.DialContext = (&net.Dialer{Timeout: requestTimeout}).DialContext
+		tr.ResponseHeaderTimeout = requestTimeout
+	}
 
 	rp := &httputil.ReverseProxy{
 		Director: func(req *http.Request) {
 			req.URL.Scheme = "https"
-			req.URL.Host = p.localAddr
+			req.URL.Host = p.pickBackend(req)
 			if p.hostHeaderRewrite != "" {
 				req.Host = p.hostHeaderRewrite
 			}
@@ -82,11 +142,23 @@ func NewHTTP2HTTPSPlugin(params map[string]string) (Plugin, error) {
 				req.Header.Set(k, v)
 			}
 		},
-		Transport: tr,
+		ModifyResponse: p.modifyResponse,
+		ErrorHandler:   bodyLimitErrorHandler,
+		Transport:      tr,
+	}
+	if maintenancePageFile != "" {
+		rp.ErrorHandler = makeMaintenanceErrorHandler(maintenancePageFile, maintenanceStatusCode)
 	}
 
+	var handler http.Handler = makeHTTPRequestBodyLimitHandler(rp, maxRequestBodySize)
+	if enableCompression {
+		handler = makeHTTPCompressionHandler(handler, compressionAlgorithms)
+	}
+	if enableAccessLog {
+		handler = makeHTTPAccessLogHandler(PluginHTTP2HTTPS, handler)
+	}
 	p.s = &http.Server{
-		Handler: rp,
+		Handler: handler,
 	}
 
 	go p.s.Serve(listener)
@@ -94,6 +166,55 @@ func NewHTTP2HTTPSPlugin(params map[string]string) (Plugin, error) {
 	return p, nil
 }
 
+// pickBackend selects the backend for a request: the one pinned by the
+// sticky session cookie when present and still valid, otherwise the next one
+// in round-robin order.
+func (p *HTTP2HTTPSPlugin) pickBackend(req *http.Request) string {
+	if p.stickySessionCookie != "" {
+		if c, err := req.Cookie(p.stickySessionCookie); err == nil {
+			if idx, err := strconv.Atoi(c.Value); err == nil && idx >= 0 && idx < len(p.localAddrs) {
+				return p.localAddrs[idx]
+			}
+		}
+	}
+	n := atomic.AddUint64(&p.nextBackend, 1)
+	return p.localAddrs[(n-1)%uint64(len(p.localAddrs))]
+}
+
+func (p *HTTP2HTTPSPlugin) modifyResponse(resp *http.Response) error {
+	if err := p.setStickyCookie(resp); err != nil {
+		return err
+	}
+	rewriteRedirectLocation(resp, p.rewriteRedirectHost)
+	return limitResponseBody(resp, p.maxResponseBodySize)
+}
+
+// setStickyCookie pins the client to the backend that served this response.
+func (p *HTTP2HTTPSPlugin) setStickyCookie(resp *http.Response) error {
+	if p.stickySessionCookie == "" {
+		return nil
+	}
+	idx := 0
+	for i, addr := range p.localAddrs {
+		if addr == resp.Request.URL.Host {
+			idx = i
+			break
+		}
+	}
+	value := strconv.Itoa(idx)
+	if c, err := resp.Request.Cookie(p.stickySessionCookie); err == nil && c.Value == value {
+		return nil
+	}
+	cookie := &http.Cookie{
+		Name:     p.stickySessionCookie,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+	}
+	resp.Header.Add("Set-Cookie", cookie.String())
+	return nil
+}
+
 func (p *HTTP2HTTPSPlugin) Handle(conn io.ReadWriteCloser, realConn net.Conn, extraBufToLocal []byte) {
 	wrapConn := frpNet.WrapReadWriteCloserToConn(conn, realConn)
 	p.l.PutConn(wrapConn)
@@ -17,6 +17,7 @@ package plugin
 import (
 	"bufio"
 	"encoding/base64"
+	"fmt"
 	"io"
 	"net"
 	"net/http"
@@ -39,17 +40,23 @@ type HTTPProxy struct {
 	s          *http.Server
 	AuthUser   string
 	AuthPasswd string
+	AuthRealm  string
 }
 
 func NewHTTPProxyPlugin(params map[string]string) (Plugin, error) {
 	user := params["plugin_http_user"]
 	passwd := params["plugin_http_passwd"]
+	authRealm := params["plugin_auth_realm"]
+	if authRealm == "" {
+		authRealm = "frp"
+	}
 	listener := NewProxyListener()
 
 	hp := &HTTPProxy{
 		l:          listener,
 		AuthUser:   user,
 		AuthPasswd: passwd,
+		AuthRealm:  authRealm,
 	}
 
 	hp.s = &http.Server{
@@ -98,7 +105,7 @@ func (hp *HTTPProxy) Close() error {
 
 func (hp *HTTPProxy) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	if ok := hp.Auth(req); !ok {
-		rw.Header().Set("Proxy-Authenticate", "Basic")
+		rw.Header().Set("Proxy-Authenticate", fmt.Sprintf("Basic realm=%q", hp.AuthRealm))
 		rw.WriteHeader(http.StatusProxyAuthRequired)
 		return
 	}
@@ -187,7 +194,7 @@ func (hp *HTTPProxy) Auth(req *http.Request) bool {
 func (hp *HTTPProxy) handleConnectReq(req *http.Request, rwc io.ReadWriteCloser) {
 	defer rwc.Close()
 	if ok := hp.Auth(req); !ok {
-		res := getBadResponse()
+		res := hp.getBadResponse()
 		res.Write(rwc)
 		return
 	}
@@ -228,9 +235,9 @@ func removeProxyHeaders(req *http.Request) {
 	req.Header.Del("Upgrade")
 }
 
-func getBadResponse() *http.Response {
+func (hp *HTTPProxy) getBadResponse() *http.Response {
 	header := make(map[string][]string)
-	header["Proxy-Authenticate"] = []string{"Basic"}
+	header["Proxy-Authenticate"] = []string{fmt.Sprintf("Basic realm=%q", hp.AuthRealm)}
 	header["Connection"] = []string{"close"}
 	res := &http.Response{
 		Status:     "407 Not authorized",
@@ -16,13 +16,19 @@ package plugin
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/http/httputil"
+	"strconv"
 	"strings"
 
+	"github.com/quic-go/quic-go/http3"
+
+	"github.com/fatedier/frp/pkg/util/log"
 	frpNet "github.com/fatedier/frp/pkg/util/net"
 )
 
@@ -35,19 +41,28 @@ func init() {
 type HTTPS2HTTPPlugin struct {
 	crtPath           string
 	keyPath           string
+	clientCAPath      string
+	requireClientCert bool
 	hostHeaderRewrite string
 	localAddr         string
 	headers           map[string]string
 
-	l *Listener
-	s *http.Server
+	rewriteRedirectHost string
+
+	maxResponseBodySize int64
+
+	l  *Listener
+	s  *http.Server
+	h3 *http3.Server
 }
 
 func NewHTTPS2HTTPPlugin(params map[string]string) (Plugin, error) {
 	crtPath := params["plugin_crt_path"]
 	keyPath := params["plugin_key_path"]
+	clientCAPath := params["plugin_client_ca_path"]
 	localAddr := params["plugin_local_addr"]
 	hostHeaderRewrite := params["plugin_host_header_rewrite"]
+	rewriteRedirectHost := params["plugin_rewrite_redirect_host"]
 	headers := make(map[string]string)
 	for k, v := range params {
 		if !strings.HasPrefix(k, "plugin_header_") {
@@ -68,15 +83,89 @@ func NewHTTPS2HTTPPlugin(params map[string]string) (Plugin, error) {
 		return nil, fmt.Errorf("plugin_local_addr is required")
 	}
 
+	requireClientCert := false
+	if str := params["plugin_require_client_cert"]; str != "" {
+		v, err := strconv.ParseBool(str)
+		if err != nil {
+			return nil, fmt.Errorf("invalid plugin_require_client_cert [%s]", str)
+		}
+		requireClientCert = v
+	}
+
+	// HTTP/3 runs over UDP, which the stream-based plugin transport cannot
+	// carry, so the QUIC listener binds plugin_http3_bind_addr directly;
+	// that port is typically exposed through a companion udp proxy, and
+	// responses served over the tunnel advertise it via Alt-Svc
+	enableHTTP3 := false
+	if str := params["plugin_enable_http3"]; str != "" {
+		v, err := strconv.ParseBool(str)
+		if err != nil {
+			return nil, fmt.Errorf("invalid plugin_enable_http3 [%s]", str)
+		}
+		enableHTTP3 = v
+	}
+	http3BindAddr := params["plugin_http3_bind_addr"]
+	http3AdvertisePort := 0
+	if enableHTTP3 {
+		if http3BindAddr == "" {
+			return nil, fmt.Errorf("plugin_http3_bind_addr is required when plugin_enable_http3 is true")
+		}
+		if str := params["plugin_http3_advertise_port"]; str != "" {
+			n, err := strconv.Atoi(str)
+			if err != nil || n <= 0 || n > 65535 {
+				return nil, fmt.Errorf("invalid plugin_http3_advertise_port [%s]", str)
+			}
+			http3AdvertisePort = n
+		}
+	}
+	if requireClientCert && clientCAPath == "" {
+		return nil, fmt.Errorf("plugin_client_ca_path is required when plugin_require_client_cert is true")
+	}
+
+	requestTimeout, err := parsePluginRequestTimeout(params)
+	if err != nil {
+		return nil, err
+	}
+	enableCompression, err := parsePluginEnableCompression(params)
+	if err != nil {
+		return nil, err
+	}
+	var compressionAlgorithms []string
+	if enableCompression {
+		compressionAlgorithms, err = parsePluginCompressionAlgorithms(params)
+		if err != nil {
+			return nil, err
+		}
+	}
+	enableAccessLog, err := parsePluginEnableAccessLog(params)
+	if err != nil {
+		return nil, err
+	}
+	maxRequestBodySize, maxResponseBodySize, err := parsePluginMaxBodySizes(params)
+	if err != nil {
+		return nil, err
+	}
+	maintenancePageFile, maintenanceStatusCode, err := parsePluginMaintenancePage(params)
+	if err != nil {
+		return nil, err
+	}
+
 	listener := NewProxyListener()
 
 	p := &HTTPS2HTTPPlugin{
 		crtPath:           crtPath,
 		keyPath:           keyPath,
+		clientCAPath:      clientCAPath,
+		requireClientCert: requireClientCert,
 		localAddr:         localAddr,
 		hostHeaderRewrite: hostHeaderRewrite,
 		headers:           headers,
-		l:                 listener,
+
+		rewriteRedirectHost: rewriteRedirectHost,
+
+		maxResponseBodySize: maxResponseBodySize,
+
+		l: listener,
 	}
 
 	rp := &httputil.ReverseProxy{
@@ -90,16 +179,66 @@ func NewHTTPS2HTTPPlugin(params map[string]string) (Plugin, error) {
 				req.Header.Set(k, v)
 			}
 		},
+		ModifyResponse: func(resp *http.Response) error {
+			rewriteRedirectLocation(resp, p.rewriteRedirectHost)
+			return limitResponseBody(resp, p.maxResponseBodySize)
+		},
+		ErrorHandler: bodyLimitErrorHandler,
 	}
-
-	p.s = &http.Server{
-		Handler: rp,
+	if maintenancePageFile != "" {
+		rp.ErrorHandler = makeMaintenanceErrorHandler(maintenancePageFile, maintenanceStatusCode)
+	}
+	if requestTimeout > 0 {
+		rp.Transport = &http.Transport{
+			DialContext:           (&net.Dialer{Timeout: requestTimeout}).DialContext,
+			ResponseHeaderTimeout: requestTimeout,
+		}
 	}
 
 	tlsConfig, err := p.genTLSConfig()
 	if err != nil {
 		return nil, fmt.Errorf("gen TLS config error: %v", err)
 	}
+
+	var handler http.Handler = makeHTTPRequestBodyLimitHandler(rp, maxRequestBodySize)
+	if enableCompression {
+		handler = makeHTTPCompressionHandler(handler, compressionAlgorithms)
+	}
+	if enableAccessLog {
+		handler = makeHTTPAccessLogHandler(PluginHTTPS2HTTP, handler)
+	}
+
+	if enableHTTP3 {
+		// bind the UDP port synchronously so a busy or invalid
+		// plugin_http3_bind_addr fails the plugin instead of silently
+		// disabling HTTP/3 while Alt-Svc keeps advertising it
+		udpConn, err := net.ListenPacket("udp", http3BindAddr)
+		if err != nil {
+			return nil, fmt.Errorf("listen plugin_http3_bind_addr [%s] error: %v", http3BindAddr, err)
+		}
+		p.h3 = &http3.Server{
+			Addr:      http3BindAddr,
+			Port:      http3AdvertisePort,
+			TLSConfig: tlsConfig,
+			Handler:   handler,
+		}
+		inner := handler
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// a failure here only means the response goes out without an
+			// Alt-Svc header, so clients simply stay on HTTP/1 or HTTP/2
+			p.h3.SetQuicHeaders(w.Header())
+			inner.ServeHTTP(w, r)
+		})
+		go func() {
+			if err := p.h3.Serve(udpConn); err != nil && err != http.ErrServerClosed {
+				log.Warn("[%s] http3 server exited: %v", PluginHTTPS2HTTP, err)
+			}
+		}()
+	}
+
+	p.s = &http.Server{
+		Handler: handler,
+	}
 	ln := tls.NewListener(listener, tlsConfig)
 
 	go p.s.Serve(ln)
@@ -113,6 +252,25 @@ func (p *HTTPS2HTTPPlugin) genTLSConfig() (*tls.Config, error) {
 	}
 
 	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if p.clientCAPath != "" {
+		pem, err := ioutil.ReadFile(p.clientCAPath)
+		if err != nil {
+			return nil, fmt.Errorf("read plugin_client_ca_path error: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid certificate in plugin_client_ca_path [%s]", p.clientCAPath)
+		}
+		config.ClientCAs = pool
+		// certificates are always verified against the CA bundle when
+		// presented; requireClientCert additionally rejects handshakes
+		// without one
+		if p.requireClientCert {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		} else {
+			config.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
 	return config, nil
 }
 
@@ -126,6 +284,9 @@ func (p *HTTPS2HTTPPlugin) Name() string {
 }
 
 func (p *HTTPS2HTTPPlugin) Close() error {
+	if p.h3 != nil {
+		p.h3.Close()
+	}
 	if err := p.s.Close(); err != nil {
 		return err
 	}
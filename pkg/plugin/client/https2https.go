@@ -38,6 +38,7 @@ type HTTPS2HTTPSPlugin struct {
 	hostHeaderRewrite string
 	localAddr         string
 	headers           map[string]string
+	alpnProtocols     []string
 
 	l *Listener
 	s *http.Server
@@ -68,6 +69,16 @@ func NewHTTPS2HTTPSPlugin(params map[string]string) (Plugin, error) {
 		return nil, fmt.Errorf("plugin_local_addr is required")
 	}
 
+	requestTimeout, err := parsePluginRequestTimeout(params)
+	if err != nil {
+		return nil, err
+	}
+
+	alpnProtocols, err := parsePluginALPNProtocols(params)
+	if err != nil {
+		return nil, err
+	}
+
 	listener := NewProxyListener()
 
 	p := &HTTPS2HTTPSPlugin{
@@ -76,11 +87,19 @@ func NewHTTPS2HTTPSPlugin(params map[string]string) (Plugin, error) {
 		localAddr:         localAddr,
 		hostHeaderRewrite: hostHeaderRewrite,
 		headers:           headers,
+		alpnProtocols:     alpnProtocols,
 		l:                 listener,
 	}
 
 	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true,
+			NextProtos:         alpnProtocols,
+		},
+	}
+	if requestTimeout > 0 {
+		tr.DialContext = (&net.Dialer{Timeout: requestTimeout}).DialContext
+		tr.ResponseHeaderTimeout = requestTimeout
 	}
 
 	rp := &httputil.ReverseProxy{
@@ -117,7 +136,10 @@ func (p *HTTPS2HTTPSPlugin) genTLSConfig() (*tls.Config, error) {
 		return nil, err
 	}
 
-	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   p.alpnProtocols,
+	}
 	return config, nil
 }
 
@@ -0,0 +1,69 @@
+// Copyright 2021 The frp Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// parsePluginMaintenancePage parses the optional plugin_maintenance_page_file
+// and plugin_maintenance_status_code parameters shared by the reverse proxy
+// plugins. The file must exist when configured; the status code defaults to
+// 503. An empty file keeps the usual 502 behavior.
+func parsePluginMaintenancePage(params map[string]string) (string, int, error) {
+	pageFile := params["plugin_maintenance_page_file"]
+	if pageFile == "" {
+		return "", 0, nil
+	}
+	if _, err := os.Stat(pageFile); err != nil {
+		return "", 0, fmt.Errorf("invalid plugin_maintenance_page_file: %v", err)
+	}
+	statusCode := http.StatusServiceUnavailable
+	if str := params["plugin_maintenance_status_code"]; str != "" {
+		n, err := strconv.Atoi(str)
+		if err != nil || n < 400 || n > 599 {
+			return "", 0, fmt.Errorf("invalid plugin_maintenance_status_code [%s]", str)
+		}
+		statusCode = n
+	}
+	return pageFile, statusCode, nil
+}
+
+// makeMaintenanceErrorHandler returns a reverse proxy error handler that
+// serves the maintenance page when the upstream fails, instead of a bare
+// 502. Body-limit errors keep their usual mapping, and the page is read per
+// request so it can be edited without restarting the plugin.
+func makeMaintenanceErrorHandler(pageFile string, statusCode int) func(http.ResponseWriter, *http.Request, error) {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		if errors.Is(err, errResponseBodyTooLarge) || strings.Contains(err.Error(), "request body too large") {
+			bodyLimitErrorHandler(w, r, err)
+			return
+		}
+		content, readErr := ioutil.ReadFile(pageFile)
+		if readErr != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(statusCode)
+		w.Write(content)
+	}
+}
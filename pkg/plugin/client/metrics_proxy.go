@@ -0,0 +1,109 @@
+// Copyright 2021 The frp Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+
+	frpNet "github.com/fatedier/frp/pkg/util/net"
+)
+
+const PluginMetricsProxy = "metrics_proxy"
+
+func init() {
+	Register(PluginMetricsProxy, NewMetricsProxyPlugin)
+}
+
+// MetricsProxyPlugin exposes a local Prometheus scrape endpoint through the
+// tunnel. Unlike the full reverse-proxy plugins it only permits GET /metrics
+// and requires a bearer token, so nothing else on the backend is reachable.
+type MetricsProxyPlugin struct {
+	localAddr   string
+	bearerToken string
+
+	l *Listener
+	s *http.Server
+}
+
+func NewMetricsProxyPlugin(params map[string]string) (Plugin, error) {
+	localAddr := params["plugin_local_addr"]
+	bearerToken := params["plugin_bearer_token"]
+
+	if localAddr == "" {
+		return nil, fmt.Errorf("plugin_local_addr is required")
+	}
+	if bearerToken == "" {
+		return nil, fmt.Errorf("plugin_bearer_token is required")
+	}
+
+	listener := NewProxyListener()
+
+	p := &MetricsProxyPlugin{
+		localAddr:   localAddr,
+		bearerToken: bearerToken,
+
+		l: listener,
+	}
+
+	rp := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = "http"
+			req.URL.Host = p.localAddr
+		},
+	}
+
+	p.s = &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/metrics" {
+				http.NotFound(w, r)
+				return
+			}
+			if r.Method != http.MethodGet {
+				http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+				return
+			}
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(p.bearerToken)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			rp.ServeHTTP(w, r)
+		}),
+	}
+
+	go p.s.Serve(listener)
+
+	return p, nil
+}
+
+func (p *MetricsProxyPlugin) Handle(conn io.ReadWriteCloser, realConn net.Conn, extraBufToLocal []byte) {
+	wrapConn := frpNet.WrapReadWriteCloserToConn(conn, realConn)
+	p.l.PutConn(wrapConn)
+}
+
+func (p *MetricsProxyPlugin) Name() string {
+	return PluginMetricsProxy
+}
+
+func (p *MetricsProxyPlugin) Close() error {
+	return p.s.Close()
+}
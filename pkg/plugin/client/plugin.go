@@ -18,7 +18,11 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"net/http"
+	"net/url"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/fatedier/golib/errors"
 )
@@ -90,3 +94,56 @@ func (l *Listener) Close() error {
 func (l *Listener) Addr() net.Addr {
 	return (*net.TCPAddr)(nil)
 }
+
+// parsePluginRequestTimeout parses the optional plugin_request_timeout
+// parameter shared by the reverse proxy plugins. 0 means no timeout.
+func parsePluginRequestTimeout(params map[string]string) (time.Duration, error) {
+	str := params["plugin_request_timeout"]
+	if str == "" {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(str)
+	if err != nil || timeout < 0 {
+		return 0, fmt.Errorf("invalid plugin_request_timeout [%s]", str)
+	}
+	return timeout, nil
+}
+
+// parsePluginALPNProtocols parses the optional comma separated
+// plugin_alpn_protocols parameter, e.g. "h2,http/1.1". An empty parameter
+// returns nil so TLS negotiation keeps its default behavior.
+func parsePluginALPNProtocols(params map[string]string) ([]string, error) {
+	str := params["plugin_alpn_protocols"]
+	if str == "" {
+		return nil, nil
+	}
+	protocols := make([]string, 0)
+	for _, proto := range strings.Split(str, ",") {
+		proto = strings.TrimSpace(proto)
+		if proto == "" {
+			return nil, fmt.Errorf("invalid plugin_alpn_protocols [%s]", str)
+		}
+		protocols = append(protocols, proto)
+	}
+	return protocols, nil
+}
+
+// rewriteRedirectLocation rewrites the host of an absolute Location header on
+// redirect responses, so a backend redirecting to its internal address sends
+// clients to the externally visible host instead. Relative locations are left
+// alone.
+func rewriteRedirectLocation(resp *http.Response, host string) {
+	if host == "" || resp.StatusCode < 300 || resp.StatusCode >= 400 {
+		return
+	}
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return
+	}
+	u, err := url.Parse(location)
+	if err != nil || u.Host == "" {
+		return
+	}
+	u.Host = host
+	resp.Header.Set("Location", u.String())
+}
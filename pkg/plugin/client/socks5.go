@@ -15,14 +15,23 @@
 package plugin
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"net"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
 
+	"github.com/fatedier/frp/pkg/util/limit"
 	frpNet "github.com/fatedier/frp/pkg/util/net"
 
 	gosocks5 "github.com/armon/go-socks5"
+	frpIo "github.com/fatedier/golib/io"
+	"golang.org/x/time/rate"
 )
 
 const PluginSocks5 = "socks5"
@@ -36,11 +45,35 @@ type Socks5Plugin struct {
 
 	user   string
 	passwd string
+
+	// maxConnections and bytesPerSecond bound how much a single tunneled
+	// socks5 client can consume; 0 means unlimited
+	maxConnections int64
+	bytesPerSecond int64
+	curConnections int64
 }
 
 func NewSocks5Plugin(params map[string]string) (p Plugin, err error) {
 	user := params["plugin_user"]
 	passwd := params["plugin_passwd"]
+	allowedDestinations := params["plugin_allowed_destinations"]
+	allowedHostPatterns := params["plugin_allowed_host_patterns"]
+
+	var maxConnections, bytesPerSecond int64
+	if str := params["plugin_max_connections"]; str != "" {
+		maxConnections, err = strconv.ParseInt(str, 10, 64)
+		if err != nil || maxConnections < 0 {
+			err = fmt.Errorf("invalid plugin_max_connections [%s]", str)
+			return
+		}
+	}
+	if str := params["plugin_bytes_per_second"]; str != "" {
+		bytesPerSecond, err = strconv.ParseInt(str, 10, 64)
+		if err != nil || bytesPerSecond < 0 {
+			err = fmt.Errorf("invalid plugin_bytes_per_second [%s]", str)
+			return
+		}
+	}
 
 	cfg := &gosocks5.Config{
 		Logger: log.New(ioutil.Discard, "", log.LstdFlags),
@@ -48,14 +81,152 @@ func NewSocks5Plugin(params map[string]string) (p Plugin, err error) {
 	if user != "" || passwd != "" {
 		cfg.Credentials = gosocks5.StaticCredentials(map[string]string{user: passwd})
 	}
-	sp := &Socks5Plugin{}
+	if allowedDestinations != "" {
+		rules, errRet := newDestinationRuleSet(strings.Split(allowedDestinations, ","))
+		if errRet != nil {
+			err = errRet
+			return
+		}
+		cfg.Rules = rules
+	}
+	if allowedHostPatterns != "" {
+		resolver, errRet := newHostPatternResolver(strings.Split(allowedHostPatterns, ","))
+		if errRet != nil {
+			err = errRet
+			return
+		}
+		cfg.Resolver = resolver
+	}
+	sp := &Socks5Plugin{
+		maxConnections: maxConnections,
+		bytesPerSecond: bytesPerSecond,
+	}
 	sp.Server, err = gosocks5.New(cfg)
 	p = sp
 	return
 }
 
+// hostPatternResolver rejects CONNECT hostnames matching none of the allowed
+// patterns before any DNS resolution happens, so blocked names are never
+// leaked to the resolver. Patterns use path.Match style wildcards, e.g.
+// "*.internal.example.com".
+type hostPatternResolver struct {
+	patterns []string
+	next     gosocks5.NameResolver
+}
+
+func newHostPatternResolver(entries []string) (gosocks5.NameResolver, error) {
+	r := &hostPatternResolver{next: gosocks5.DNSResolver{}}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if _, err := path.Match(entry, ""); err != nil {
+			return nil, fmt.Errorf("invalid plugin_allowed_host_patterns entry [%s]", entry)
+		}
+		r.patterns = append(r.patterns, entry)
+	}
+	if len(r.patterns) == 0 {
+		return nil, fmt.Errorf("plugin_allowed_host_patterns shouldn't be empty")
+	}
+	return r, nil
+}
+
+func (r *hostPatternResolver) Resolve(ctx context.Context, name string) (context.Context, net.IP, error) {
+	for _, pattern := range r.patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return r.next.Resolve(ctx, name)
+		}
+	}
+	return ctx, nil, fmt.Errorf("host [%s] is not allowed", name)
+}
+
+// destinationRuleSet only permits CONNECT requests whose destination matches
+// one of the configured CIDR blocks or host[:port] patterns. Host patterns
+// may contain path.Match style wildcards.
+type destinationRuleSet struct {
+	cidrs    []*net.IPNet
+	patterns []string
+}
+
+func newDestinationRuleSet(entries []string) (gosocks5.RuleSet, error) {
+	r := &destinationRuleSet{}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			r.cidrs = append(r.cidrs, ipNet)
+			continue
+		}
+		host := entry
+		if h, _, err := net.SplitHostPort(entry); err == nil {
+			host = h
+		}
+		if _, err := path.Match(host, ""); err != nil {
+			return nil, fmt.Errorf("invalid plugin_allowed_destinations entry [%s]", entry)
+		}
+		r.patterns = append(r.patterns, entry)
+	}
+	if len(r.cidrs) == 0 && len(r.patterns) == 0 {
+		return nil, fmt.Errorf("plugin_allowed_destinations shouldn't be empty")
+	}
+	return r, nil
+}
+
+func (r *destinationRuleSet) Allow(ctx context.Context, req *gosocks5.Request) (context.Context, bool) {
+	dest := req.DestAddr
+	if dest == nil {
+		return ctx, false
+	}
+	for _, ipNet := range r.cidrs {
+		if dest.IP != nil && ipNet.Contains(dest.IP) {
+			return ctx, true
+		}
+	}
+
+	hosts := make([]string, 0, 2)
+	if dest.FQDN != "" {
+		hosts = append(hosts, dest.FQDN)
+	}
+	if dest.IP != nil {
+		hosts = append(hosts, dest.IP.String())
+	}
+	port := strconv.Itoa(dest.Port)
+	for _, pattern := range r.patterns {
+		patternHost := pattern
+		patternPort := ""
+		if h, p, err := net.SplitHostPort(pattern); err == nil {
+			patternHost, patternPort = h, p
+		}
+		if patternPort != "" && patternPort != port {
+			continue
+		}
+		for _, host := range hosts {
+			if matched, _ := path.Match(patternHost, host); matched {
+				return ctx, true
+			}
+		}
+	}
+	return ctx, false
+}
+
 func (sp *Socks5Plugin) Handle(conn io.ReadWriteCloser, realConn net.Conn, extraBufToLocal []byte) {
 	defer conn.Close()
+	if sp.maxConnections > 0 {
+		if atomic.AddInt64(&sp.curConnections, 1) > sp.maxConnections {
+			atomic.AddInt64(&sp.curConnections, -1)
+			return
+		}
+		defer atomic.AddInt64(&sp.curConnections, -1)
+	}
+
+	if sp.bytesPerSecond > 0 {
+		limiter := rate.NewLimiter(rate.Limit(float64(sp.bytesPerSecond)), int(sp.bytesPerSecond))
+		conn = frpIo.WrapReadWriteCloser(limit.NewReader(conn, limiter), limit.NewWriter(conn, limiter), conn.Close)
+	}
 	wrapConn := frpNet.WrapReadWriteCloserToConn(conn, realConn)
 	sp.Server.ServeConn(wrapConn)
 }
@@ -15,9 +15,15 @@
 package plugin
 
 import (
+	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	frpNet "github.com/fatedier/frp/pkg/util/net"
 
@@ -31,10 +37,24 @@ func init() {
 }
 
 type StaticFilePlugin struct {
-	localPath   string
-	stripPrefix string
-	httpUser    string
-	httpPasswd  string
+	localPath    string
+	stripPrefix  string
+	httpUser     string
+	httpPasswd   string
+	indexFile    string
+	notFoundFile string
+	cacheControl string
+
+	// enableDirListing controls whether directories without an index file
+	// render a listing (the default) or return 403
+	enableDirListing bool
+	// mimeOverrides maps file extensions (without the dot) to content types
+	mimeOverrides map[string]string
+	// responseHeaders are set on every response, e.g. security headers like
+	// Content-Security-Policy
+	responseHeaders map[string]string
+
+	fileServer http.Handler
 
 	l *Listener
 	s *http.Server
@@ -45,14 +65,63 @@ func NewStaticFilePlugin(params map[string]string) (Plugin, error) {
 	stripPrefix := params["plugin_strip_prefix"]
 	httpUser := params["plugin_http_user"]
 	httpPasswd := params["plugin_http_passwd"]
+	indexFile := params["plugin_index_file"]
+	notFoundFile := params["plugin_404_file"]
+	cacheControl := params["plugin_cache_control"]
+	authRealm := params["plugin_auth_realm"]
+	if authRealm == "" {
+		authRealm = "frp"
+	}
+
+	enableDirListing := true
+	if str := params["plugin_enable_dir_listing"]; str != "" {
+		v, err := strconv.ParseBool(str)
+		if err != nil {
+			return nil, fmt.Errorf("invalid plugin_enable_dir_listing [%s]", str)
+		}
+		enableDirListing = v
+	}
+
+	mimeOverrides := make(map[string]string)
+	for k, v := range params {
+		if !strings.HasPrefix(k, "plugin_mime_") {
+			continue
+		}
+		if k = strings.TrimPrefix(k, "plugin_mime_"); k != "" {
+			mimeOverrides[k] = v
+		}
+	}
+
+	responseHeaders := make(map[string]string)
+	for k, v := range params {
+		if !strings.HasPrefix(k, "plugin_response_header_") {
+			continue
+		}
+		if k = strings.TrimPrefix(k, "plugin_response_header_"); k != "" {
+			responseHeaders[k] = v
+		}
+	}
+
+	if indexFile == "" {
+		indexFile = "index.html"
+	}
 
 	listener := NewProxyListener()
 
 	sp := &StaticFilePlugin{
-		localPath:   localPath,
-		stripPrefix: stripPrefix,
-		httpUser:    httpUser,
-		httpPasswd:  httpPasswd,
+		localPath:    localPath,
+		stripPrefix:  stripPrefix,
+		httpUser:     httpUser,
+		httpPasswd:   httpPasswd,
+		indexFile:    indexFile,
+		notFoundFile: notFoundFile,
+		cacheControl: cacheControl,
+
+		enableDirListing: enableDirListing,
+		mimeOverrides:    mimeOverrides,
+		responseHeaders:  responseHeaders,
+
+		fileServer: http.FileServer(http.Dir(localPath)),
 
 		l: listener,
 	}
@@ -64,8 +133,8 @@ func NewStaticFilePlugin(params map[string]string) (Plugin, error) {
 	}
 
 	router := mux.NewRouter()
-	router.Use(frpNet.NewHTTPAuthMiddleware(httpUser, httpPasswd).Middleware)
-	router.PathPrefix(prefix).Handler(frpNet.MakeHTTPGzipHandler(http.StripPrefix(prefix, http.FileServer(http.Dir(localPath))))).Methods("GET")
+	router.Use(frpNet.NewHTTPAuthMiddleware(httpUser, httpPasswd).SetRealm(authRealm).Middleware)
+	router.PathPrefix(prefix).Handler(frpNet.MakeHTTPGzipHandler(http.StripPrefix(prefix, sp))).Methods("GET")
 	sp.s = &http.Server{
 		Handler: router,
 	}
@@ -73,6 +142,64 @@ func NewStaticFilePlugin(params map[string]string) (Plugin, error) {
 	return sp, nil
 }
 
+// ServeHTTP serves files under localPath, using indexFile for directory
+// requests and notFoundFile (when configured) as the body of 404 responses.
+func (sp *StaticFilePlugin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for k, v := range sp.responseHeaders {
+		w.Header().Set(k, v)
+	}
+
+	upath := strings.TrimPrefix(filepath.Clean("/"+r.URL.Path), "/")
+	name := filepath.Join(sp.localPath, upath)
+
+	fi, err := os.Stat(name)
+	if err == nil && fi.IsDir() {
+		idx := filepath.Join(name, sp.indexFile)
+		ifi, ierr := os.Stat(idx)
+		switch {
+		case ierr == nil && !ifi.IsDir():
+			name, fi = idx, ifi
+		case !sp.enableDirListing:
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		default:
+			sp.fileServer.ServeHTTP(w, r)
+			return
+		}
+	}
+	if err != nil {
+		sp.serveNotFound(w, r)
+		return
+	}
+
+	if ext := strings.TrimPrefix(filepath.Ext(name), "."); ext != "" {
+		if contentType, ok := sp.mimeOverrides[ext]; ok {
+			w.Header().Set("Content-Type", contentType)
+		}
+	}
+
+	// http.ServeFile already handles Last-Modified/If-Modified-Since; setting
+	// an ETag beforehand makes it honor If-None-Match with 304 as well
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, fi.ModTime().Unix(), fi.Size()))
+	if sp.cacheControl != "" {
+		w.Header().Set("Cache-Control", sp.cacheControl)
+	}
+	http.ServeFile(w, r, name)
+}
+
+func (sp *StaticFilePlugin) serveNotFound(w http.ResponseWriter, r *http.Request) {
+	if sp.notFoundFile != "" {
+		content, err := ioutil.ReadFile(filepath.Join(sp.localPath, sp.notFoundFile))
+		if err == nil {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.WriteHeader(http.StatusNotFound)
+			w.Write(content)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
 func (sp *StaticFilePlugin) Handle(conn io.ReadWriteCloser, realConn net.Conn, extraBufToLocal []byte) {
 	wrapConn := frpNet.WrapReadWriteCloserToConn(conn, realConn)
 	sp.l.PutConn(wrapConn)
@@ -0,0 +1,107 @@
+// Copyright 2021 The frp Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"fmt"
+	"io"
+	"net"
+
+	frpIo "github.com/fatedier/golib/io"
+	pp "github.com/pires/go-proxyproto"
+)
+
+const PluginTCP2TCPProxyProto = "tcp2tcp_proxyproto"
+
+func init() {
+	Register(PluginTCP2TCPProxyProto, NewTCP2TCPProxyProtoPlugin)
+}
+
+// TCP2TCPProxyProtoPlugin relays TCP to a local backend, prepending a PROXY
+// protocol header so backends like HAProxy or nginx learn the real client
+// address. When frp already built a header (proxy_protocol_version set on
+// the proxy), it is forwarded unchanged; otherwise a header without address
+// information is sent, since the plugin only sees frp's own work connection
+// and has no real client address to report.
+type TCP2TCPProxyProtoPlugin struct {
+	localAddr string
+	version   byte
+}
+
+func NewTCP2TCPProxyProtoPlugin(params map[string]string) (Plugin, error) {
+	localAddr := params["plugin_local_addr"]
+	if localAddr == "" {
+		return nil, fmt.Errorf("plugin_local_addr is required")
+	}
+
+	version := byte(2)
+	switch params["plugin_proxy_protocol_version"] {
+	case "", "v2", "2":
+	case "v1", "1":
+		version = 1
+	default:
+		return nil, fmt.Errorf("invalid plugin_proxy_protocol_version [%s]", params["plugin_proxy_protocol_version"])
+	}
+
+	return &TCP2TCPProxyProtoPlugin{
+		localAddr: localAddr,
+		version:   version,
+	}, nil
+}
+
+func (p *TCP2TCPProxyProtoPlugin) Handle(conn io.ReadWriteCloser, realConn net.Conn, extraBufToLocal []byte) {
+	defer conn.Close()
+
+	localConn, err := net.Dial("tcp", p.localAddr)
+	if err != nil {
+		return
+	}
+
+	if len(extraBufToLocal) > 0 {
+		if _, err := localConn.Write(extraBufToLocal); err != nil {
+			localConn.Close()
+			return
+		}
+	} else if err := p.writeLocalHeader(localConn); err != nil {
+		localConn.Close()
+		return
+	}
+
+	frpIo.Join(localConn, conn)
+}
+
+// writeLocalHeader sends a header carrying no address information ("PROXY
+// UNKNOWN" in v1, a LOCAL command in v2) when frp didn't pass a header along,
+// so backends that require the protocol still accept the connection. The work
+// connection addresses are frp endpoints, not the real client, so
+// synthesizing a PROXY header from them would report the frps server as the
+// client address.
+func (p *TCP2TCPProxyProtoPlugin) writeLocalHeader(localConn net.Conn) error {
+	h := &pp.Header{
+		Version:           p.version,
+		Command:           pp.LOCAL,
+		TransportProtocol: pp.UNSPEC,
+	}
+	_, err := h.WriteTo(localConn)
+	return err
+}
+
+func (p *TCP2TCPProxyProtoPlugin) Name() string {
+	return PluginTCP2TCPProxyProto
+}
+
+func (p *TCP2TCPProxyProtoPlugin) Close() error {
+	return nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2021 The frp Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"fmt"
+	"io"
+	"net"
+
+	frpIo "github.com/fatedier/golib/io"
+)
+
+const PluginTCP2UDS = "tcp2uds"
+
+func init() {
+	Register(PluginTCP2UDS, NewTCP2UDSPlugin)
+}
+
+// TCP2UDSPlugin proxies incoming tunneled TCP connections to a service that
+// only listens on a local Unix domain socket.
+type TCP2UDSPlugin struct {
+	unixAddr *net.UnixAddr
+}
+
+func NewTCP2UDSPlugin(params map[string]string) (Plugin, error) {
+	unixPath := params["plugin_unix_path"]
+	if unixPath == "" {
+		return nil, fmt.Errorf("plugin_unix_path is required")
+	}
+
+	unixAddr, err := net.ResolveUnixAddr("unix", unixPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TCP2UDSPlugin{
+		unixAddr: unixAddr,
+	}, nil
+}
+
+func (p *TCP2UDSPlugin) Handle(conn io.ReadWriteCloser, realConn net.Conn, extraBufToLocal []byte) {
+	localConn, err := net.DialUnix("unix", nil, p.unixAddr)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	if len(extraBufToLocal) > 0 {
+		localConn.Write(extraBufToLocal)
+	}
+
+	frpIo.Join(localConn, conn)
+}
+
+func (p *TCP2UDSPlugin) Name() string {
+	return PluginTCP2UDS
+}
+
+func (p *TCP2UDSPlugin) Close() error {
+	return nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2021 The frp Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	frpIo "github.com/fatedier/golib/io"
+)
+
+const PluginTCPMux = "tcp_mux"
+
+// routingTokenMaxLen bounds the first line read from a connection; a client
+// that doesn't send a newline within this many bytes is disconnected.
+const routingTokenMaxLen = 1024
+
+func init() {
+	Register(PluginTCPMux, NewTCPMuxPlugin)
+}
+
+// TCPMuxPlugin fans a single proxy out to several local services. The client
+// sends a routing token as the first line of the connection; the token
+// selects the backend and is consumed, everything after it is forwarded
+// as-is. Connections with an unknown token are closed.
+type TCPMuxPlugin struct {
+	routes map[string]string
+}
+
+func NewTCPMuxPlugin(params map[string]string) (Plugin, error) {
+	// params with prefix "plugin_route_" map routing tokens to backends,
+	// e.g. plugin_route_web = 127.0.0.1:8080
+	routes := make(map[string]string)
+	for k, v := range params {
+		if !strings.HasPrefix(k, "plugin_route_") {
+			continue
+		}
+		token := strings.TrimPrefix(k, "plugin_route_")
+		if token == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(v); err != nil {
+			return nil, fmt.Errorf("invalid address [%s] for plugin_route_%s", v, token)
+		}
+		routes[token] = v
+	}
+	if len(routes) == 0 {
+		return nil, fmt.Errorf("at least one plugin_route_<token> is required")
+	}
+
+	return &TCPMuxPlugin{
+		routes: routes,
+	}, nil
+}
+
+func (p *TCPMuxPlugin) Handle(conn io.ReadWriteCloser, realConn net.Conn, extraBufToLocal []byte) {
+	reader := bufio.NewReaderSize(io.MultiReader(bytes.NewReader(extraBufToLocal), conn), routingTokenMaxLen)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	addr, ok := p.routes[strings.TrimSpace(line)]
+	if !ok {
+		conn.Close()
+		return
+	}
+
+	localConn, err := net.Dial("tcp", addr)
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	// reads must go through the bufio reader so bytes buffered past the
+	// routing token aren't lost
+	rwc := frpIo.WrapReadWriteCloser(reader, conn, func() error {
+		return conn.Close()
+	})
+	frpIo.Join(localConn, rwc)
+}
+
+func (p *TCPMuxPlugin) Name() string {
+	return PluginTCPMux
+}
+
+func (p *TCPMuxPlugin) Close() error {
+	return nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2021 The frp Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"fmt"
+	"io"
+	"net"
+)
+
+const PluginTCPTee = "tcp_tee"
+
+func init() {
+	Register(PluginTCPTee, NewTCPTeePlugin)
+}
+
+// TCPTeePlugin duplicates inbound bytes to a primary and a shadow backend,
+// returning only the primary's responses. The shadow path is best effort:
+// dial or write failures there never affect the primary connection.
+type TCPTeePlugin struct {
+	primaryAddr string
+	shadowAddr  string
+}
+
+func NewTCPTeePlugin(params map[string]string) (Plugin, error) {
+	primaryAddr := params["plugin_primary_addr"]
+	shadowAddr := params["plugin_shadow_addr"]
+
+	if primaryAddr == "" {
+		return nil, fmt.Errorf("plugin_primary_addr is required")
+	}
+	if shadowAddr == "" {
+		return nil, fmt.Errorf("plugin_shadow_addr is required")
+	}
+
+	return &TCPTeePlugin{
+		primaryAddr: primaryAddr,
+		shadowAddr:  shadowAddr,
+	}, nil
+}
+
+// bestEffortWriter forwards writes to the shadow backend and swallows
+// errors; after the first failure the shadow is abandoned.
+type bestEffortWriter struct {
+	w      io.WriteCloser
+	failed bool
+}
+
+func (b *bestEffortWriter) Write(p []byte) (int, error) {
+	if !b.failed {
+		if _, err := b.w.Write(p); err != nil {
+			b.failed = true
+			b.w.Close()
+		}
+	}
+	return len(p), nil
+}
+
+func (p *TCPTeePlugin) Handle(conn io.ReadWriteCloser, realConn net.Conn, extraBufToLocal []byte) {
+	defer conn.Close()
+
+	primary, err := net.Dial("tcp", p.primaryAddr)
+	if err != nil {
+		return
+	}
+	defer primary.Close()
+
+	toLocal := io.Writer(primary)
+	if shadow, err := net.Dial("tcp", p.shadowAddr); err == nil {
+		defer shadow.Close()
+		toLocal = io.MultiWriter(primary, &bestEffortWriter{w: shadow})
+	}
+
+	if len(extraBufToLocal) > 0 {
+		if _, err := toLocal.Write(extraBufToLocal); err != nil {
+			return
+		}
+	}
+
+	go func() {
+		io.Copy(conn, primary)
+		conn.Close()
+		primary.Close()
+	}()
+	io.Copy(toLocal, conn)
+	primary.Close()
+}
+
+func (p *TCPTeePlugin) Name() string {
+	return PluginTCPTee
+}
+
+func (p *TCPTeePlugin) Close() error {
+	return nil
+}
@@ -0,0 +1,149 @@
+// Copyright 2021 The frp Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	frpNet "github.com/fatedier/frp/pkg/util/net"
+
+	frpIo "github.com/fatedier/golib/io"
+)
+
+const PluginTLS2Raw = "tls2raw"
+
+func init() {
+	Register(PluginTLS2Raw, NewTLS2RawPlugin)
+}
+
+// TLS2RawPlugin terminates TLS on tunneled connections and forwards the
+// plaintext stream to a local service. Multiple upstream addresses can be
+// configured; they are tried in order and the first one that dials
+// successfully wins.
+type TLS2RawPlugin struct {
+	crtPath    string
+	keyPath    string
+	localAddrs []string
+
+	// sniRoutes maps a client's SNI server name to a dedicated backend,
+	// letting one exposed port serve several local services; unmatched names
+	// fall back to localAddrs
+	sniRoutes map[string]string
+
+	tlsConfig *tls.Config
+}
+
+func NewTLS2RawPlugin(params map[string]string) (Plugin, error) {
+	crtPath := params["plugin_crt_path"]
+	keyPath := params["plugin_key_path"]
+	localAddr := params["plugin_local_addr"]
+	localAddrs := make([]string, 0, 1)
+	if localAddr != "" {
+		localAddrs = append(localAddrs, localAddr)
+	}
+	for _, addr := range strings.Split(params["plugin_local_addrs"], ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			localAddrs = append(localAddrs, addr)
+		}
+	}
+
+	if crtPath == "" {
+		return nil, fmt.Errorf("plugin_crt_path is required")
+	}
+	if keyPath == "" {
+		return nil, fmt.Errorf("plugin_key_path is required")
+	}
+	if len(localAddrs) == 0 {
+		return nil, fmt.Errorf("plugin_local_addr or plugin_local_addrs is required")
+	}
+
+	// params with prefix "plugin_sni_route_" map server names to backends,
+	// e.g. plugin_sni_route_app.example.com = 127.0.0.1:8080
+	sniRoutes := make(map[string]string)
+	for k, v := range params {
+		if !strings.HasPrefix(k, "plugin_sni_route_") {
+			continue
+		}
+		name := strings.ToLower(strings.TrimPrefix(k, "plugin_sni_route_"))
+		if name == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(v); err != nil {
+			return nil, fmt.Errorf("invalid address [%s] for plugin_sni_route_%s", v, name)
+		}
+		sniRoutes[name] = v
+	}
+
+	cert, err := tls.LoadX509KeyPair(crtPath, keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TLS2RawPlugin{
+		crtPath:    crtPath,
+		keyPath:    keyPath,
+		localAddrs: localAddrs,
+		sniRoutes:  sniRoutes,
+		tlsConfig:  &tls.Config{Certificates: []tls.Certificate{cert}},
+	}, nil
+}
+
+func (p *TLS2RawPlugin) Handle(conn io.ReadWriteCloser, realConn net.Conn, extraBufToLocal []byte) {
+	wrapConn := frpNet.WrapReadWriteCloserToConn(conn, realConn)
+	tlsConn := tls.Server(wrapConn, p.tlsConfig)
+
+	localAddrs := p.localAddrs
+	if len(p.sniRoutes) > 0 {
+		// the handshake reads the ClientHello, making the SNI available
+		// before the backend is dialed
+		if err := tlsConn.Handshake(); err != nil {
+			tlsConn.Close()
+			return
+		}
+		if addr, ok := p.sniRoutes[strings.ToLower(tlsConn.ConnectionState().ServerName)]; ok {
+			localAddrs = []string{addr}
+		}
+	}
+
+	var localConn net.Conn
+	for _, addr := range localAddrs {
+		var err error
+		if localConn, err = net.Dial("tcp", addr); err == nil {
+			break
+		}
+		localConn = nil
+	}
+	if localConn == nil {
+		tlsConn.Close()
+		return
+	}
+	if len(extraBufToLocal) > 0 {
+		localConn.Write(extraBufToLocal)
+	}
+
+	frpIo.Join(localConn, tlsConn)
+}
+
+func (p *TLS2RawPlugin) Name() string {
+	return PluginTLS2Raw
+}
+
+func (p *TLS2RawPlugin) Close() error {
+	return nil
+}
@@ -0,0 +1,149 @@
+// Copyright 2021 The frp Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+const PluginUDP2UDP = "udp2udp"
+
+func init() {
+	Register(PluginUDP2UDP, NewUDP2UDPPlugin)
+}
+
+// UDP2UDPPlugin relays datagrams to a local UDP backend. Each tunneled
+// connection carries one source's datagrams with the two bytes length prefix
+// also used by dns2doh, and maps to its own UDP socket towards the backend,
+// so replies find their way back to the right source. Sessions idle in both
+// directions longer than the session timeout are dropped.
+type UDP2UDPPlugin struct {
+	localAddr      string
+	sessionTimeout time.Duration
+}
+
+func NewUDP2UDPPlugin(params map[string]string) (Plugin, error) {
+	localAddr := params["plugin_local_addr"]
+	if localAddr == "" {
+		return nil, fmt.Errorf("plugin_local_addr is required")
+	}
+
+	sessionTimeout := 60 * time.Second
+	if str := params["plugin_session_timeout"]; str != "" {
+		timeout, err := time.ParseDuration(str)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid plugin_session_timeout [%s]", str)
+		}
+		sessionTimeout = timeout
+	}
+
+	return &UDP2UDPPlugin{
+		localAddr:      localAddr,
+		sessionTimeout: sessionTimeout,
+	}, nil
+}
+
+func (p *UDP2UDPPlugin) Handle(conn io.ReadWriteCloser, realConn net.Conn, extraBufToLocal []byte) {
+	defer conn.Close()
+
+	raddr, err := net.ResolveUDPAddr("udp", p.localAddr)
+	if err != nil {
+		return
+	}
+	udpConn, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		return
+	}
+	defer udpConn.Close()
+
+	var lastActive int64
+	touch := func() { atomic.StoreInt64(&lastActive, time.Now().UnixNano()) }
+	touch()
+
+	// reap the session when both directions have been quiet for the timeout
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go func() {
+		ticker := time.NewTicker(p.sessionTimeout / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+				idle := time.Now().UnixNano() - atomic.LoadInt64(&lastActive)
+				if idle > int64(p.sessionTimeout) {
+					conn.Close()
+					udpConn.Close()
+					return
+				}
+			}
+		}
+	}()
+
+	// backend -> tunnel
+	go func() {
+		buf := make([]byte, 65535)
+		lenBuf := make([]byte, 2)
+		for {
+			n, err := udpConn.Read(buf)
+			if err != nil {
+				conn.Close()
+				return
+			}
+			touch()
+			binary.BigEndian.PutUint16(lenBuf, uint16(n))
+			if _, err := conn.Write(append(lenBuf, buf[:n]...)); err != nil {
+				udpConn.Close()
+				return
+			}
+		}
+	}()
+
+	// tunnel -> backend
+	var rd io.Reader = conn
+	if len(extraBufToLocal) > 0 {
+		rd = io.MultiReader(bytes.NewReader(extraBufToLocal), conn)
+	}
+	lenBuf := make([]byte, 2)
+	for {
+		if _, err := io.ReadFull(rd, lenBuf); err != nil {
+			return
+		}
+		length := binary.BigEndian.Uint16(lenBuf)
+		packetBuf := make([]byte, length)
+		if _, err := io.ReadFull(rd, packetBuf); err != nil {
+			return
+		}
+		touch()
+		if _, err := udpConn.Write(packetBuf); err != nil {
+			return
+		}
+	}
+}
+
+func (p *UDP2UDPPlugin) Name() string {
+	return PluginUDP2UDP
+}
+
+func (p *UDP2UDPPlugin) Close() error {
+	return nil
+}
@@ -0,0 +1,146 @@
+// Copyright 2021 The frp Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	frpNet "github.com/fatedier/frp/pkg/util/net"
+
+	"github.com/gorilla/websocket"
+)
+
+const PluginWS2TCP = "ws2tcp"
+
+func init() {
+	Register(PluginWS2TCP, NewWS2TCPPlugin)
+}
+
+// WS2TCPPlugin accepts WebSocket upgrade requests on the tunneled HTTP
+// connection and bridges the binary frames to a raw TCP connection, so
+// browser clients can reach TCP-only backends.
+type WS2TCPPlugin struct {
+	localAddr string
+	path      string
+
+	l *Listener
+	s *http.Server
+
+	upgrader websocket.Upgrader
+}
+
+func NewWS2TCPPlugin(params map[string]string) (Plugin, error) {
+	localAddr := params["plugin_local_addr"]
+	path := params["plugin_path"]
+
+	if localAddr == "" {
+		return nil, fmt.Errorf("plugin_local_addr is required")
+	}
+	if path == "" {
+		path = "/"
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	listener := NewProxyListener()
+
+	p := &WS2TCPPlugin{
+		localAddr: localAddr,
+		path:      path,
+		l:         listener,
+		upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, p.serveWS)
+	p.s = &http.Server{
+		Handler: mux,
+	}
+	go p.s.Serve(listener)
+	return p, nil
+}
+
+func (p *WS2TCPPlugin) serveWS(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != p.path {
+		http.NotFound(w, r)
+		return
+	}
+
+	wsConn, err := p.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer wsConn.Close()
+
+	tcpConn, err := net.Dial("tcp", p.localAddr)
+	if err != nil {
+		return
+	}
+	defer tcpConn.Close()
+
+	errCh := make(chan error, 2)
+	go func() {
+		for {
+			_, data, err := wsConn.ReadMessage()
+			if err != nil {
+				errCh <- err
+				return
+			}
+			if _, err := tcpConn.Write(data); err != nil {
+				errCh <- err
+				return
+			}
+		}
+	}()
+	go func() {
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := tcpConn.Read(buf)
+			if n > 0 {
+				if werr := wsConn.WriteMessage(websocket.BinaryMessage, buf[:n]); werr != nil {
+					errCh <- werr
+					return
+				}
+			}
+			if err != nil {
+				errCh <- err
+				return
+			}
+		}
+	}()
+	<-errCh
+}
+
+func (p *WS2TCPPlugin) Handle(conn io.ReadWriteCloser, realConn net.Conn, extraBufToLocal []byte) {
+	wrapConn := frpNet.WrapReadWriteCloserToConn(conn, realConn)
+	p.l.PutConn(wrapConn)
+}
+
+func (p *WS2TCPPlugin) Name() string {
+	return PluginWS2TCP
+}
+
+func (p *WS2TCPPlugin) Close() error {
+	p.s.Close()
+	p.l.Close()
+	return nil
+}
@@ -0,0 +1,169 @@
+// Copyright 2021 The frp Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"fmt"
+	"io"
+	"net"
+
+	frpIo "github.com/fatedier/golib/io"
+)
+
+const PluginSocks5 = "socks5"
+
+const (
+	socks5Version            = 0x05
+	socks5MethodNoAuth       = 0x00
+	socks5MethodUserPass     = 0x02
+	socks5MethodNoAcceptable = 0xFF
+
+	socks5UserPassVersion = 0x01
+)
+
+func init() {
+	Register(PluginSocks5, NewSocks5Plugin)
+}
+
+// Socks5Plugin turns a visitor into a local socks proxy to the remote
+// network: it terminates the SOCKS5 method negotiation on the visitor side,
+// enforcing plugin_username/plugin_password before anything enters the
+// tunnel, then negotiates no-auth with the socks5 server plugin on the
+// remote frpc and splices the connections, so the client's CONNECT request
+// is served by the remote end. Credentials never cross the tunnel.
+type Socks5Plugin struct {
+	username string
+	password string
+}
+
+func NewSocks5Plugin(params map[string]string) (Plugin, error) {
+	username := params["plugin_username"]
+	password := params["plugin_password"]
+	if (username == "") != (password == "") {
+		return nil, fmt.Errorf("plugin_username and plugin_password must be set together")
+	}
+	return &Socks5Plugin{
+		username: username,
+		password: password,
+	}, nil
+}
+
+func (p *Socks5Plugin) Handle(userConn net.Conn, tunnelConn io.ReadWriteCloser) {
+	defer userConn.Close()
+	defer tunnelConn.Close()
+
+	if err := p.handshakeUser(userConn); err != nil {
+		return
+	}
+	if err := handshakeRemote(tunnelConn); err != nil {
+		return
+	}
+	frpIo.Join(userConn, tunnelConn)
+}
+
+// handshakeUser performs the RFC 1928 method negotiation with the local
+// client, requiring username/password authentication when credentials are
+// configured and no-auth otherwise.
+func (p *Socks5Plugin) handshakeUser(conn net.Conn) error {
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+	if buf[0] != socks5Version {
+		return fmt.Errorf("unsupported socks version [%d]", buf[0])
+	}
+	methods := make([]byte, int(buf[1]))
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return err
+	}
+
+	want := byte(socks5MethodNoAuth)
+	if p.username != "" {
+		want = socks5MethodUserPass
+	}
+	offered := false
+	for _, m := range methods {
+		if m == want {
+			offered = true
+			break
+		}
+	}
+	if !offered {
+		conn.Write([]byte{socks5Version, socks5MethodNoAcceptable})
+		return fmt.Errorf("client offered no acceptable authentication method")
+	}
+	if _, err := conn.Write([]byte{socks5Version, want}); err != nil {
+		return err
+	}
+	if want == socks5MethodUserPass {
+		return p.verifyUserPass(conn)
+	}
+	return nil
+}
+
+// verifyUserPass runs the RFC 1929 username/password subnegotiation.
+func (p *Socks5Plugin) verifyUserPass(conn net.Conn) error {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	if header[0] != socks5UserPassVersion {
+		return fmt.Errorf("unsupported auth subnegotiation version [%d]", header[0])
+	}
+	username := make([]byte, int(header[1]))
+	if _, err := io.ReadFull(conn, username); err != nil {
+		return err
+	}
+	plen := make([]byte, 1)
+	if _, err := io.ReadFull(conn, plen); err != nil {
+		return err
+	}
+	password := make([]byte, int(plen[0]))
+	if _, err := io.ReadFull(conn, password); err != nil {
+		return err
+	}
+
+	if string(username) != p.username || string(password) != p.password {
+		conn.Write([]byte{socks5UserPassVersion, 0x01})
+		return fmt.Errorf("invalid username or password")
+	}
+	_, err := conn.Write([]byte{socks5UserPassVersion, 0x00})
+	return err
+}
+
+// handshakeRemote negotiates no-auth with the socks5 server plugin on the
+// remote side of the tunnel; after it succeeds the client's CONNECT request
+// flows through unchanged.
+func handshakeRemote(tunnel io.ReadWriter) error {
+	if _, err := tunnel.Write([]byte{socks5Version, 1, socks5MethodNoAuth}); err != nil {
+		return err
+	}
+	resp := make([]byte, 2)
+	if _, err := io.ReadFull(tunnel, resp); err != nil {
+		return err
+	}
+	if resp[0] != socks5Version || resp[1] != socks5MethodNoAuth {
+		return fmt.Errorf("remote socks5 server rejected the connection")
+	}
+	return nil
+}
+
+func (p *Socks5Plugin) Name() string {
+	return PluginSocks5
+}
+
+func (p *Socks5Plugin) Close() error {
+	return nil
+}
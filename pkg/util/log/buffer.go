@@ -0,0 +1,103 @@
+// Copyright 2021 The frp Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// bufferSize bounds how many recent log entries are kept in memory for the
+// admin API; older entries are dropped.
+const bufferSize = 1000
+
+// Entry is one captured log record.
+type Entry struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Message string    `json:"msg"`
+}
+
+// levelValues mirrors the numeric levels used by SetLogLevel; lower is more
+// severe.
+var levelValues = map[string]int{
+	"error": 3,
+	"warn":  4,
+	"info":  6,
+	"debug": 7,
+	"trace": 8,
+}
+
+var (
+	bufferMu sync.Mutex
+	buffer   []Entry
+)
+
+// record appends a log entry to the in-memory buffer, dropping the oldest
+// entry once the buffer is full. Entries below the configured log level are
+// skipped, matching what the configured log output would show.
+func record(level string, format string, v ...interface{}) {
+	if levelValues[level] > currentLevel {
+		return
+	}
+	bufferMu.Lock()
+	defer bufferMu.Unlock()
+	buffer = append(buffer, Entry{
+		Time:    time.Now(),
+		Level:   level,
+		Message: fmt.Sprintf(format, v...),
+	})
+	if len(buffer) > bufferSize {
+		buffer = buffer[len(buffer)-bufferSize:]
+	}
+}
+
+// Record adds an entry to the in-memory buffer without writing anything to
+// the log output, for callers like xlog that talk to the underlying logger
+// directly to keep the reported call depth correct.
+func Record(level string, format string, v ...interface{}) {
+	record(level, format, v...)
+}
+
+// ValidLevel reports whether level names a known log level.
+func ValidLevel(level string) bool {
+	_, ok := levelValues[level]
+	return ok
+}
+
+// Recent returns a copy of the buffered log entries, oldest first. A
+// non-empty level keeps only entries at that severity or worse, a non-zero
+// since keeps only entries after that time, and a positive limit caps the
+// result to the most recent entries.
+func Recent(level string, since time.Time, limit int) []Entry {
+	bufferMu.Lock()
+	defer bufferMu.Unlock()
+
+	out := make([]Entry, 0, len(buffer))
+	for _, e := range buffer {
+		if level != "" && levelValues[e.Level] > levelValues[level] {
+			continue
+		}
+		if !since.IsZero() && !e.Time.After(since) {
+			continue
+		}
+		out = append(out, e)
+	}
+	if limit > 0 && len(out) > limit {
+		out = out[len(out)-limit:]
+	}
+	return out
+}
@@ -49,6 +49,10 @@ func SetLogFile(logWay string, logFile string, maxdays int64, disableLogColor bo
 	}
 }
 
+// currentLevel is the numeric level set via SetLogLevel, also consulted by
+// the in-memory buffer in buffer.go.
+var currentLevel = 4 // warning
+
 // SetLogLevel set log level, default is warning
 // value: error, warning, info, debug, trace
 func SetLogLevel(logLevel string) {
@@ -67,27 +71,33 @@ func SetLogLevel(logLevel string) {
 	default:
 		level = 4
 	}
+	currentLevel = level
 	Log.SetLevel(level)
 }
 
 // wrap log
 
 func Error(format string, v ...interface{}) {
+	record("error", format, v...)
 	Log.Error(format, v...)
 }
 
 func Warn(format string, v ...interface{}) {
+	record("warn", format, v...)
 	Log.Warn(format, v...)
 }
 
 func Info(format string, v ...interface{}) {
+	record("info", format, v...)
 	Log.Info(format, v...)
 }
 
 func Debug(format string, v ...interface{}) {
+	record("debug", format, v...)
 	Log.Debug(format, v...)
 }
 
 func Trace(format string, v ...interface{}) {
+	record("trace", format, v...)
 	Log.Trace(format, v...)
 }
@@ -16,6 +16,7 @@ package net
 
 import (
 	"compress/gzip"
+	"fmt"
 	"io"
 	"net/http"
 	"strings"
@@ -48,6 +49,7 @@ func (aw *HTTPAuthWraper) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 type HTTPAuthMiddleware struct {
 	user   string
 	passwd string
+	realm  string
 }
 
 func NewHTTPAuthMiddleware(user, passwd string) *HTTPAuthMiddleware {
@@ -57,6 +59,13 @@ func NewHTTPAuthMiddleware(user, passwd string) *HTTPAuthMiddleware {
 	}
 }
 
+// SetRealm overrides the realm reported in the WWW-Authenticate challenge,
+// which defaults to "Restricted".
+func (authMid *HTTPAuthMiddleware) SetRealm(realm string) *HTTPAuthMiddleware {
+	authMid.realm = realm
+	return authMid
+}
+
 func (authMid *HTTPAuthMiddleware) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		reqUser, reqPasswd, hasAuth := r.BasicAuth()
@@ -64,7 +73,11 @@ func (authMid *HTTPAuthMiddleware) Middleware(next http.Handler) http.Handler {
 			(hasAuth && reqUser == authMid.user && reqPasswd == authMid.passwd) {
 			next.ServeHTTP(w, r)
 		} else {
-			w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
+			realm := authMid.realm
+			if realm == "" {
+				realm = "Restricted"
+			}
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", realm))
 			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 		}
 	})
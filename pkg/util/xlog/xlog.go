@@ -53,21 +53,26 @@ func (l *Logger) Spawn() *Logger {
 }
 
 func (l *Logger) Error(format string, v ...interface{}) {
+	log.Record("error", l.prefixString+format, v...)
 	log.Log.Error(l.prefixString+format, v...)
 }
 
 func (l *Logger) Warn(format string, v ...interface{}) {
+	log.Record("warn", l.prefixString+format, v...)
 	log.Log.Warn(l.prefixString+format, v...)
 }
 
 func (l *Logger) Info(format string, v ...interface{}) {
+	log.Record("info", l.prefixString+format, v...)
 	log.Log.Info(l.prefixString+format, v...)
 }
 
 func (l *Logger) Debug(format string, v ...interface{}) {
+	log.Record("debug", l.prefixString+format, v...)
 	log.Log.Debug(l.prefixString+format, v...)
 }
 
 func (l *Logger) Trace(format string, v ...interface{}) {
+	log.Record("trace", l.prefixString+format, v...)
 	log.Log.Trace(l.prefixString+format, v...)
 }